@@ -0,0 +1,113 @@
+//
+// admin notes, the export notes are kept as individual entries (with their date and author
+// when we can find them) and a note recording the import is added
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// admin note sources
+const (
+	noteSourceExport = "export" // came with the work
+	noteSourceImport = "import" // added by the importer
+)
+
+// an admin note as stored in the admin-notes field (a JSON array of these)
+type AdminNote struct {
+	Date   string `json:"date,omitempty"`   // when the note was made (YYYY-MM-DDTHH:MM:SSZ)
+	Author string `json:"author,omitempty"` // who made it
+	Text   string `json:"text"`
+	Source string `json:"source"` // export or import
+}
+
+// a leading date or timestamp, optionally in brackets and followed by a separator
+var noteDateRe = regexp.MustCompile(`(?s)^\[?(\d{4}-\d{2}-\d{2}(?:[T ]\d{2}:\d{2}(?::\d{2})?(?:\.\d+)?(?:\s?(?:Z|UTC|[+-]\d{2}:?\d{2}))?)?|\d{1,2}/\d{1,2}/\d{4})\]?\s*(?:[:|-]\s*)?(.*)$`)
+
+// a leading author (computing id or email address) followed by a separator
+var noteAuthorRe = regexp.MustCompile(`(?is)^(?:by\s+)?([a-z]{2,3}[0-9][a-z]{0,3}|[^\s@:]+@[^\s@:]+)\s*[:-]\s*(.*)$`)
+
+// the timestamp layouts we understand
+var noteDateLayouts = []string{
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"1/2/2006",
+}
+
+// parse the export note, anything we do not recognize is left in the text
+func parseAdminNote(str string) AdminNote {
+
+	note := AdminNote{Text: strings.TrimSpace(str), Source: noteSourceExport}
+
+	if m := noteDateRe.FindStringSubmatch(note.Text); m != nil {
+		date := parseNoteDate(m[1])
+		if len(date) != 0 {
+			note.Date = date
+			note.Text = strings.TrimSpace(m[2])
+		}
+	}
+	if m := noteAuthorRe.FindStringSubmatch(note.Text); m != nil && len(strings.TrimSpace(m[2])) != 0 {
+		note.Author = m[1]
+		note.Text = strings.TrimSpace(m[2])
+	}
+	return note
+}
+
+func parseNoteDate(str string) string {
+	str = strings.Replace(str, " UTC", " +0000", 1)
+	for _, layout := range noteDateLayouts {
+		tm, err := time.Parse(layout, str)
+		if err == nil {
+			return tm.UTC().Format("2006-01-02T15:04:05Z")
+		}
+	}
+	return ""
+}
+
+// the note recording the import
+func provenanceNote(run importRun, dirname string) AdminNote {
+	source := relativePath(run.root, dirname)
+	if len(source) == 0 {
+		source = dirname
+	}
+	return AdminNote{
+		Date:   run.started.UTC().Format("2006-01-02T15:04:05Z"),
+		Text:   fmt.Sprintf("Imported from %s by import run %s", source, run.id),
+		Source: noteSourceImport,
+	}
+}
+
+// the admin notes for the work, the export notes in their original order followed by the
+// import note, serialized for the admin-notes field
+func makeAdminNotes(notes []string, run importRun, dirname string) (string, error) {
+	result := make([]AdminNote, 0, len(notes)+1)
+	for _, n := range notes {
+		if len(strings.TrimSpace(n)) != 0 {
+			result = append(result, parseAdminNote(n))
+		}
+	}
+	result = append(result, provenanceNote(run, dirname))
+
+	buf, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+//
+// end of file
+//
@@ -0,0 +1,86 @@
+//
+// tests for the admin notes
+//
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseAdminNote(t *testing.T) {
+
+	tests := []struct {
+		note     string
+		expected AdminNote
+	}{
+		{"a plain note", AdminNote{Text: "a plain note"}},
+		{"2019-05-01: a dated note", AdminNote{Date: "2019-05-01T00:00:00Z", Text: "a dated note"}},
+		{"[2019-05-01 12:30:00 UTC] a timestamped note", AdminNote{Date: "2019-05-01T12:30:00Z", Text: "a timestamped note"}},
+		{"2019-05-01T12:30:00-04:00 - abc1x: both", AdminNote{Date: "2019-05-01T16:30:00Z", Author: "abc1x", Text: "both"}},
+		{"5/1/2019 someone@virginia.edu: by email", AdminNote{Date: "2019-05-01T00:00:00Z", Author: "someone@virginia.edu", Text: "by email"}},
+		{"by xyz9q - author only", AdminNote{Author: "xyz9q", Text: "author only"}},
+		{"2019-13-45: not a date", AdminNote{Text: "2019-13-45: not a date"}},
+		{"Note: not an author", AdminNote{Text: "Note: not an author"}},
+		{"abc1x:", AdminNote{Text: "abc1x:"}},
+		{"2020-01-01\nline one\nline two", AdminNote{Date: "2020-01-01T00:00:00Z", Text: "line one\nline two"}},
+	}
+
+	for _, test := range tests {
+		test.expected.Source = noteSourceExport
+		if got := parseAdminNote(test.note); got != test.expected {
+			t.Errorf("parseAdminNote(%q) = %+v, expected %+v", test.note, got, test.expected)
+		}
+	}
+}
+
+func TestMakeAdminNotes(t *testing.T) {
+
+	run := importRun{id: "run-1", root: "/exports/2024", started: time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)}
+	str, err := makeAdminNotes([]string{"second", " ", "first"}, run, "/exports/2024/etd/abc")
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+
+	var notes []AdminNote
+	if err = json.Unmarshal([]byte(str), &notes); err != nil {
+		t.Fatalf("bad notes (%s)", err.Error())
+	}
+	if len(notes) != 3 || notes[0].Text != "second" || notes[1].Text != "first" {
+		t.Fatalf("expected the export notes in order, got %+v", notes)
+	}
+	expected := AdminNote{Date: "2024-02-03T04:05:06Z", Text: "Imported from etd/abc by import run run-1", Source: noteSourceImport}
+	if notes[2] != expected {
+		t.Errorf("expected the provenance note %+v, got %+v", expected, notes[2])
+	}
+}
+
+func TestNewImportRun(t *testing.T) {
+	started := time.Date(2024, 2, 3, 4, 5, 6, 0, time.FixedZone("EST", -5*3600))
+	if run := newImportRun("shared", "/exports", started); run.id != "shared" || run.root != "/exports" || run.export != "/exports" ||
+		run.started != started.UTC() {
+		t.Errorf("expected the specified run id, got %+v", run)
+	}
+
+	// local exports are recorded with an absolute path
+	cwd, _ := os.Getwd()
+	if run := newImportRun("", "testdata/fixtures", started); run.root != "testdata/fixtures" || run.export != filepath.Join(cwd, "testdata/fixtures") {
+		t.Errorf("expected an absolute export location, got %+v", run)
+	}
+	if run := newImportRun("", "s3://bucket/exports", started); run.export != "s3://bucket/exports" {
+		t.Errorf("expected the S3 location unchanged, got %+v", run)
+	}
+
+	a, b := newImportRun("", "", started), newImportRun("", "", started)
+	if len(a.id) == 0 || a.id == b.id {
+		t.Errorf("expected unique generated run ids, got %q and %q", a.id, b.id)
+	}
+}
+
+//
+// end of file
+//
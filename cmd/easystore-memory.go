@@ -0,0 +1,417 @@
+//
+// in-memory implementation of the easystore interface, used for dry runs and testing
+// when no backend is available
+//
+
+package main
+
+import (
+	"fmt"
+	"github.com/uvalib/easystore/uvaeasystore"
+	"io"
+	"sort"
+	"sync"
+)
+
+type memoryEasyStore struct {
+	sync.Mutex
+	objects map[memoryKey]*memoryObject // the objects we are storing
+	vtag    int                         // used to generate version tags
+}
+
+type memoryKey struct {
+	namespace string
+	id        string
+}
+
+// what we hold for each object
+type memoryObject struct {
+	vtag     string
+	fields   uvaeasystore.EasyStoreObjectFields
+	metadata uvaeasystore.EasyStoreMetadata
+	files    []uvaeasystore.EasyStoreBlob
+}
+
+// our object set implementation
+type memoryObjectSet struct {
+	current int
+	objects []uvaeasystore.EasyStoreObject
+}
+
+func newMemoryEasyStore() uvaeasystore.EasyStore {
+	logInfo("new memory easystore, nothing will be persisted")
+	return &memoryEasyStore{objects: make(map[memoryKey]*memoryObject)}
+}
+
+func (impl *memoryEasyStore) ObjectGetByKey(namespace string, id string, which uvaeasystore.EasyStoreComponents) (uvaeasystore.EasyStoreObject, error) {
+
+	if err := uvaeasystore.GetByKeyPreflight(namespace, id, which); err != nil {
+		return nil, err
+	}
+
+	impl.Lock()
+	defer impl.Unlock()
+
+	mo, found := impl.objects[memoryKey{namespace, id}]
+	if found == false {
+		return nil, fmt.Errorf("%q: %w", "object(s) not found", uvaeasystore.ErrNotFound)
+	}
+	return mo.object(namespace, id, which), nil
+}
+
+func (impl *memoryEasyStore) ObjectGetByKeys(namespace string, ids []string, which uvaeasystore.EasyStoreComponents) (uvaeasystore.EasyStoreObjectSet, error) {
+
+	if err := uvaeasystore.GetByKeysPreflight(namespace, ids, which); err != nil {
+		return nil, err
+	}
+
+	impl.Lock()
+	defer impl.Unlock()
+
+	objs := make([]uvaeasystore.EasyStoreObject, 0)
+	for _, id := range ids {
+		mo, found := impl.objects[memoryKey{namespace, id}]
+		if found == true {
+			objs = append(objs, mo.object(namespace, id, which))
+		}
+	}
+
+	if len(objs) == 0 {
+		return nil, fmt.Errorf("%q: %w", "object(s) not found", uvaeasystore.ErrNotFound)
+	}
+	return &memoryObjectSet{objects: objs}, nil
+}
+
+func (impl *memoryEasyStore) ObjectGetByFields(namespace string, fields uvaeasystore.EasyStoreObjectFields, which uvaeasystore.EasyStoreComponents) (uvaeasystore.EasyStoreObjectSet, error) {
+
+	if err := uvaeasystore.GetByFieldsPreflight(namespace, fields, which); err != nil {
+		return nil, err
+	}
+
+	impl.Lock()
+	defer impl.Unlock()
+
+	// predictable ordering
+	keys := make([]memoryKey, 0, len(impl.objects))
+	for k := range impl.objects {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].namespace != keys[j].namespace {
+			return keys[i].namespace < keys[j].namespace
+		}
+		return keys[i].id < keys[j].id
+	})
+
+	// a blank namespace matches all namespaces, all fields must match
+	objs := make([]uvaeasystore.EasyStoreObject, 0)
+	for _, k := range keys {
+		if len(namespace) != 0 && k.namespace != namespace {
+			continue
+		}
+		mo := impl.objects[k]
+		match := true
+		for name, value := range fields {
+			if mo.fields[name] != value {
+				match = false
+				break
+			}
+		}
+		if match == true {
+			objs = append(objs, mo.object(k.namespace, k.id, which))
+		}
+	}
+	return &memoryObjectSet{objects: objs}, nil
+}
+
+func (impl *memoryEasyStore) FileGetByKey(namespace string, oid string, name string) (uvaeasystore.EasyStoreBlob, error) {
+
+	impl.Lock()
+	defer impl.Unlock()
+
+	mo, found := impl.objects[memoryKey{namespace, oid}]
+	if found == false {
+		return nil, fmt.Errorf("%q: %w", "object(s) not found", uvaeasystore.ErrNotFound)
+	}
+	for _, b := range mo.files {
+		if b.Name() == name {
+			return b, nil
+		}
+	}
+	return nil, uvaeasystore.ErrFileNotFound
+}
+
+func (impl *memoryEasyStore) Close() error {
+	return nil
+}
+
+func (impl *memoryEasyStore) Check() error {
+	return nil
+}
+
+func (impl *memoryEasyStore) ObjectCreate(obj uvaeasystore.EasyStoreObject) (uvaeasystore.EasyStoreObject, error) {
+
+	if err := uvaeasystore.ObjectCreatePreflight(obj); err != nil {
+		return nil, err
+	}
+
+	impl.Lock()
+	defer impl.Unlock()
+
+	key := memoryKey{obj.Namespace(), obj.Id()}
+	if _, found := impl.objects[key]; found == true {
+		return nil, fmt.Errorf("%q: %w", fmt.Sprintf("ns/oid [%s/%s]", key.namespace, key.id), uvaeasystore.ErrAlreadyExists)
+	}
+
+	mo := &memoryObject{
+		vtag:     impl.newVtag(),
+		fields:   copyFields(obj.Fields()),
+		metadata: obj.Metadata(),
+		files:    append([]uvaeasystore.EasyStoreBlob{}, obj.Files()...),
+	}
+	for _, b := range mo.files {
+		if blobCount(mo.files, b.Name()) > 1 {
+			return nil, fmt.Errorf("%q: %w", fmt.Sprintf("duplicate file name (%s)", b.Name()), uvaeasystore.ErrAlreadyExists)
+		}
+	}
+
+	impl.objects[key] = mo
+	return mo.object(key.namespace, key.id, uvaeasystore.AllComponents), nil
+}
+
+func (impl *memoryEasyStore) ObjectUpdate(obj uvaeasystore.EasyStoreObject, which uvaeasystore.EasyStoreComponents) (uvaeasystore.EasyStoreObject, error) {
+
+	if err := uvaeasystore.ObjectUpdatePreflight(obj, which); err != nil {
+		return nil, err
+	}
+
+	impl.Lock()
+	defer impl.Unlock()
+
+	key := memoryKey{obj.Namespace(), obj.Id()}
+	mo, err := impl.currentVersion(key, obj.VTag())
+	if err != nil {
+		return nil, err
+	}
+
+	if (which & uvaeasystore.Fields) == uvaeasystore.Fields {
+		mo.fields = copyFields(obj.Fields())
+	}
+	if (which & uvaeasystore.Files) == uvaeasystore.Files {
+		mo.files = append([]uvaeasystore.EasyStoreBlob{}, obj.Files()...)
+	}
+	if (which & uvaeasystore.Metadata) == uvaeasystore.Metadata {
+		mo.metadata = obj.Metadata()
+	}
+	mo.vtag = impl.newVtag()
+
+	return mo.object(key.namespace, key.id, uvaeasystore.AllComponents), nil
+}
+
+func (impl *memoryEasyStore) ObjectDelete(obj uvaeasystore.EasyStoreObject, which uvaeasystore.EasyStoreComponents) (uvaeasystore.EasyStoreObject, error) {
+
+	if err := uvaeasystore.ObjectDeletePreflight(obj, which); err != nil {
+		return nil, err
+	}
+
+	impl.Lock()
+	defer impl.Unlock()
+
+	key := memoryKey{obj.Namespace(), obj.Id()}
+	mo, err := impl.currentVersion(key, obj.VTag())
+	if err != nil {
+		return nil, err
+	}
+
+	// special case, the base component means delete everything
+	if which == uvaeasystore.BaseComponent {
+		delete(impl.objects, key)
+		return obj, nil
+	}
+
+	if (which & uvaeasystore.Fields) == uvaeasystore.Fields {
+		mo.fields = uvaeasystore.DefaultEasyStoreFields()
+	}
+	if (which & uvaeasystore.Files) == uvaeasystore.Files {
+		mo.files = make([]uvaeasystore.EasyStoreBlob, 0)
+	}
+	if (which & uvaeasystore.Metadata) == uvaeasystore.Metadata {
+		mo.metadata = nil
+	}
+	mo.vtag = impl.newVtag()
+
+	return obj, nil
+}
+
+func (impl *memoryEasyStore) FileCreate(namespace string, oid string, file uvaeasystore.EasyStoreBlob) error {
+
+	if err := uvaeasystore.FileCreatePreflight(namespace, oid, file); err != nil {
+		return err
+	}
+
+	impl.Lock()
+	defer impl.Unlock()
+
+	mo, err := impl.current(memoryKey{namespace, oid})
+	if err != nil {
+		return err
+	}
+	if blobCount(mo.files, file.Name()) != 0 {
+		return fmt.Errorf("%q: %w", fmt.Sprintf("duplicate file name (%s)", file.Name()), uvaeasystore.ErrAlreadyExists)
+	}
+	mo.files = append(mo.files, file)
+	mo.vtag = impl.newVtag()
+	return nil
+}
+
+func (impl *memoryEasyStore) FileDelete(namespace string, oid string, name string) error {
+
+	if err := uvaeasystore.FileDeletePreflight(namespace, oid, name); err != nil {
+		return err
+	}
+
+	impl.Lock()
+	defer impl.Unlock()
+
+	mo, err := impl.current(memoryKey{namespace, oid})
+	if err != nil {
+		return err
+	}
+	for ix, b := range mo.files {
+		if b.Name() == name {
+			mo.files = append(mo.files[:ix], mo.files[ix+1:]...)
+			mo.vtag = impl.newVtag()
+			return nil
+		}
+	}
+	return uvaeasystore.ErrFileNotFound
+}
+
+func (impl *memoryEasyStore) FileRename(namespace string, oid string, name string, newName string) error {
+
+	if err := uvaeasystore.FileRenamePreflight(namespace, oid, name, newName); err != nil {
+		return err
+	}
+
+	impl.Lock()
+	defer impl.Unlock()
+
+	mo, err := impl.current(memoryKey{namespace, oid})
+	if err != nil {
+		return err
+	}
+	if blobCount(mo.files, newName) != 0 {
+		return fmt.Errorf("%q: %w", fmt.Sprintf("duplicate file name (%s)", newName), uvaeasystore.ErrAlreadyExists)
+	}
+	for ix, b := range mo.files {
+		if b.Name() == name {
+			pl, _ := b.Payload()
+			mo.files[ix] = uvaeasystore.NewEasyStoreBlob(newName, b.MimeType(), pl)
+			mo.vtag = impl.newVtag()
+			return nil
+		}
+	}
+	return uvaeasystore.ErrFileNotFound
+}
+
+func (impl *memoryEasyStore) FileUpdate(namespace string, oid string, file uvaeasystore.EasyStoreBlob) error {
+
+	if err := uvaeasystore.FileUpdatePreflight(namespace, oid, file); err != nil {
+		return err
+	}
+
+	impl.Lock()
+	defer impl.Unlock()
+
+	mo, err := impl.current(memoryKey{namespace, oid})
+	if err != nil {
+		return err
+	}
+	for ix, b := range mo.files {
+		if b.Name() == file.Name() {
+			mo.files[ix] = file
+			mo.vtag = impl.newVtag()
+			return nil
+		}
+	}
+	return uvaeasystore.ErrFileNotFound
+}
+
+// get the current object. Must be called with the lock held
+func (impl *memoryEasyStore) current(key memoryKey) (*memoryObject, error) {
+	mo, found := impl.objects[key]
+	if found == false {
+		return nil, fmt.Errorf("%q: %w", "object(s) not found", uvaeasystore.ErrNotFound)
+	}
+	return mo, nil
+}
+
+// get the current object, the vtag must match (as it does for the real store, an empty
+// vtag is stale). Must be called with the lock held
+func (impl *memoryEasyStore) currentVersion(key memoryKey, vtag string) (*memoryObject, error) {
+	mo, err := impl.current(key)
+	if err != nil {
+		return nil, err
+	}
+	if mo.vtag != vtag {
+		logError(fmt.Sprintf("stale vtag; req [%s], cur [%s]", vtag, mo.vtag))
+		return nil, uvaeasystore.ErrStaleObject
+	}
+	return mo, nil
+}
+
+// must be called with the lock held
+func (impl *memoryEasyStore) newVtag() string {
+	impl.vtag++
+	return fmt.Sprintf("memory-%d", impl.vtag)
+}
+
+// make an easystore object containing the requested components
+func (mo *memoryObject) object(namespace string, id string, which uvaeasystore.EasyStoreComponents) uvaeasystore.EasyStoreObject {
+	obj := uvaeasystore.ProxyEasyStoreObject(namespace, id, mo.vtag)
+	if (which & uvaeasystore.Fields) == uvaeasystore.Fields {
+		obj.SetFields(copyFields(mo.fields))
+	}
+	if (which & uvaeasystore.Files) == uvaeasystore.Files {
+		obj.SetFiles(append([]uvaeasystore.EasyStoreBlob{}, mo.files...))
+	}
+	if (which & uvaeasystore.Metadata) == uvaeasystore.Metadata {
+		obj.SetMetadata(mo.metadata)
+	}
+	return obj
+}
+
+func (impl *memoryObjectSet) Count() uint {
+	return uint(len(impl.objects))
+}
+
+func (impl *memoryObjectSet) Next() (uvaeasystore.EasyStoreObject, error) {
+	if impl.current == len(impl.objects) {
+		return nil, io.EOF
+	}
+	obj := impl.objects[impl.current]
+	impl.current++
+	return obj, nil
+}
+
+func copyFields(fields uvaeasystore.EasyStoreObjectFields) uvaeasystore.EasyStoreObjectFields {
+	c := uvaeasystore.DefaultEasyStoreFields()
+	for k, v := range fields {
+		c[k] = v
+	}
+	return c
+}
+
+func blobCount(blobs []uvaeasystore.EasyStoreBlob, name string) int {
+	count := 0
+	for _, b := range blobs {
+		if b.Name() == name {
+			count++
+		}
+	}
+	return count
+}
+
+//
+// end of file
+//
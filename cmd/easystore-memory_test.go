@@ -0,0 +1,118 @@
+//
+// tests for the in-memory easystore
+//
+
+package main
+
+import (
+	"errors"
+	"github.com/uvalib/easystore/uvaeasystore"
+	"testing"
+)
+
+func TestMemoryObjectCreate(t *testing.T) {
+
+	es := newMemoryEasyStore()
+	obj := uvaeasystore.NewEasyStoreObject("ns1", "oid1")
+	obj.SetFields(uvaeasystore.EasyStoreObjectFields{"author": "abc1x"})
+
+	created, err := es.ObjectCreate(obj)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+	if len(created.VTag()) == 0 {
+		t.Fatalf("expected a vtag")
+	}
+
+	// same id, same namespace
+	_, err = es.ObjectCreate(uvaeasystore.NewEasyStoreObject("ns1", "oid1"))
+	if errors.Is(err, uvaeasystore.ErrAlreadyExists) == false {
+		t.Fatalf("expected already exists, got (%v)", err)
+	}
+
+	// same id, different namespace
+	_, err = es.ObjectCreate(uvaeasystore.NewEasyStoreObject("ns2", "oid1"))
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+
+	// blank namespace
+	_, err = es.ObjectCreate(uvaeasystore.ProxyEasyStoreObject("", "oid1", ""))
+	if errors.Is(err, uvaeasystore.ErrBadParameter) == false {
+		t.Fatalf("expected bad parameter, got (%v)", err)
+	}
+}
+
+func TestMemoryObjectGet(t *testing.T) {
+
+	es := newMemoryEasyStore()
+	obj := uvaeasystore.NewEasyStoreObject("ns1", "oid1")
+	obj.SetFields(uvaeasystore.EasyStoreObjectFields{"author": "abc1x"})
+	obj.SetFiles([]uvaeasystore.EasyStoreBlob{uvaeasystore.NewEasyStoreBlob("a.txt", "text/plain", []byte("a"))})
+	if _, err := es.ObjectCreate(obj); err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+
+	_, err := es.ObjectGetByKey("ns2", "oid1", uvaeasystore.AllComponents)
+	if errors.Is(err, uvaeasystore.ErrNotFound) == false {
+		t.Fatalf("expected not found, got (%v)", err)
+	}
+
+	base, err := es.ObjectGetByKey("ns1", "oid1", uvaeasystore.BaseComponent)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+	if len(base.Fields()) != 0 || len(base.Files()) != 0 {
+		t.Fatalf("expected base component only")
+	}
+
+	set, err := es.ObjectGetByFields("", uvaeasystore.EasyStoreObjectFields{"author": "abc1x"}, uvaeasystore.AllComponents)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+	if set.Count() != 1 {
+		t.Fatalf("expected 1 object, got %d", set.Count())
+	}
+}
+
+func TestMemoryObjectUpdateStale(t *testing.T) {
+
+	es := newMemoryEasyStore()
+	created, err := es.ObjectCreate(uvaeasystore.NewEasyStoreObject("ns1", "oid1"))
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+
+	updated, err := es.ObjectUpdate(created, uvaeasystore.Fields)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+	if updated.VTag() == created.VTag() {
+		t.Fatalf("expected a new vtag")
+	}
+
+	// the original is now stale
+	_, err = es.ObjectDelete(created, uvaeasystore.BaseComponent)
+	if errors.Is(err, uvaeasystore.ErrStaleObject) == false {
+		t.Fatalf("expected stale object, got (%v)", err)
+	}
+
+	// as is an object without a vtag
+	_, err = es.ObjectUpdate(uvaeasystore.NewEasyStoreObject("ns1", "oid1"), uvaeasystore.Fields)
+	if errors.Is(err, uvaeasystore.ErrStaleObject) == false {
+		t.Fatalf("expected stale object for an empty vtag, got (%v)", err)
+	}
+
+	_, err = es.ObjectDelete(updated, uvaeasystore.BaseComponent)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+	_, err = es.ObjectGetByKey("ns1", "oid1", uvaeasystore.AllComponents)
+	if errors.Is(err, uvaeasystore.ErrNotFound) == false {
+		t.Fatalf("expected not found, got (%v)", err)
+	}
+}
+
+//
+// end of file
+//
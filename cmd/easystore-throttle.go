@@ -0,0 +1,192 @@
+//
+// throttling for proxy mode. The easystore proxy client does not let us supply our own
+// transport so we run a local reverse proxy in front of the service that limits the
+// request rate, slows us down when the service asks us to back off and retries the request
+// when it is safe to send it again
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/uvalib/easystore/uvaeasystore"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// how many times we retry a request the service asked us to back off from
+const maxThrottleRetries = 5
+
+// the default back off when the service does not tell us how long to wait and the most
+// we will wait whatever it tells us
+const defaultRetryAfter = 2 * time.Second
+const maxRetryAfter = 60 * time.Second
+
+// request bodies larger than this are streamed to the service rather than buffered, so
+// they are not retried
+const maxRetryBody = 8 * 1024 * 1024
+
+// an easystore that limits the rate objects are created
+type throttledEasyStore struct {
+	uvaeasystore.EasyStore
+	objects *rateLimiter // objects per second
+}
+
+// the transport used by the local proxy
+type throttleTransport struct {
+	next    http.RoundTripper // the real transport
+	objects *rateLimiter      // slowed down when the service is struggling
+	bytes   *rateLimiter      // bytes per second
+}
+
+// a body that limits the rate it can be read
+type throttledBody struct {
+	io.ReadCloser
+	bytes *rateLimiter
+}
+
+// a request body that is partly buffered, the rest is still to be read
+type streamedBody struct {
+	io.Reader
+	io.Closer
+}
+
+func newThrottledEasyStore(es uvaeasystore.EasyStore, objects *rateLimiter) uvaeasystore.EasyStore {
+	return &throttledEasyStore{EasyStore: es, objects: objects}
+}
+
+func (impl *throttledEasyStore) ObjectCreate(obj uvaeasystore.EasyStoreObject) (uvaeasystore.EasyStoreObject, error) {
+	impl.objects.take(1)
+	return impl.EasyStore.ObjectCreate(obj)
+}
+
+// start the local throttling proxy in front of the service endpoint, returns the endpoint
+// to use instead
+func startThrottleProxy(endpoint string, objects *rateLimiter, byteRate *rateLimiter) (string, error) {
+
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("bad service endpoint (%s)", err.Error())
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+		},
+		Transport: &throttleTransport{next: http.DefaultTransport, objects: objects, bytes: byteRate},
+	}
+	go http.Serve(listener, proxy)
+
+	local := fmt.Sprintf("http://%s", listener.Addr().String())
+	logInfo(fmt.Sprintf("throttling proxy on %s for %s", local, endpoint))
+	return local, nil
+}
+
+func (t *throttleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	// we need the body if we retry, larger bodies are streamed instead
+	var body []byte
+	streamed := false
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(req.Body, maxRetryBody+1))
+		if err != nil {
+			req.Body.Close()
+			return nil, err
+		}
+		streamed = len(body) > maxRetryBody
+		if streamed == false {
+			req.Body.Close()
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		out := req.Clone(req.Context())
+		if streamed == true {
+			rest := streamedBody{Reader: io.MultiReader(bytes.NewReader(body), req.Body), Closer: req.Body}
+			out.Body = &throttledBody{ReadCloser: rest, bytes: t.bytes}
+		} else if body != nil {
+			t.bytes.take(float64(len(body)))
+			out.Body = io.NopCloser(bytes.NewReader(body))
+			out.ContentLength = int64(len(body))
+		}
+
+		resp, err := t.next.RoundTrip(out)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+			t.objects.recover()
+			resp.Body = &throttledBody{ReadCloser: resp.Body, bytes: t.bytes}
+			return resp, nil
+		}
+
+		// the service is struggling, slow everything down
+		wait := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		t.objects.backoff(time.Now().Add(wait))
+		if streamed == true || retryable(req.Method, resp.StatusCode) == false {
+			logError(fmt.Sprintf("%s %s returns HTTP %d, not retrying", req.Method, req.URL.Path, resp.StatusCode))
+			return resp, nil
+		}
+		if attempt == maxThrottleRetries {
+			logError(fmt.Sprintf("%s %s returns HTTP %d, giving up after %d retries", req.Method, req.URL.Path, resp.StatusCode, attempt))
+			return resp, nil
+		}
+		logWarning(fmt.Sprintf("%s %s returns HTTP %d, retrying in %s (slowdown x%.1f)", req.Method, req.URL.Path, resp.StatusCode, wait, t.objects.factor()))
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// can we send the request again. A rate limited request (429) was not processed but the
+// service may have partly processed one it could not finish (503), so only requests that
+// change nothing are retried then
+func retryable(method string, status int) bool {
+	if status == http.StatusTooManyRequests {
+		return true
+	}
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes.take(float64(n))
+	return n, err
+}
+
+// how long the service would like us to wait (up to our maximum), Retry-After is either
+// a number of seconds or an HTTP date
+func retryAfter(header string, now time.Time) time.Duration {
+	if len(header) == 0 {
+		return defaultRetryAfter
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return min(max(time.Duration(seconds)*time.Second, 0), maxRetryAfter)
+	}
+	if when, err := http.ParseTime(header); err == nil {
+		return min(max(when.Sub(now), 0), maxRetryAfter)
+	}
+	return defaultRetryAfter
+}
+
+//
+// end of file
+//
@@ -0,0 +1,178 @@
+//
+// tests for the rate limiter and the throttling proxy
+//
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+
+	rl := newRateLimiter(100)
+	start := time.Now()
+	for ix := 0; ix < 11; ix++ {
+		rl.take(1)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("expected at least 100ms for 11 units at 100/s, took %s", elapsed)
+	}
+
+	rl.backoff(time.Now())
+	rl.backoff(time.Now())
+	if rl.factor() != 4.0 {
+		t.Errorf("expected slowdown x4, got x%.1f", rl.factor())
+	}
+	for ix := 0; ix < 100; ix++ {
+		rl.recover()
+	}
+	if rl.factor() != 1.0 {
+		t.Errorf("expected full speed, got x%.1f", rl.factor())
+	}
+
+	// without a rate we only wait once we have been slowed down
+	unlimited := newRateLimiter(0)
+	start = time.Now()
+	unlimited.take(1)
+	unlimited.take(1)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("expected no wait at full speed, took %s", elapsed)
+	}
+	unlimited.backoff(time.Now())
+	start = time.Now()
+	unlimited.take(1)
+	unlimited.take(1)
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("expected at least %s between units after a back off, took %s", unlimitedSlowdownInterval, elapsed)
+	}
+
+	// no limiter, no waiting
+	var none *rateLimiter
+	none.take(1000)
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              defaultRetryAfter,
+		"3":                             3 * time.Second,
+		"Mon, 01 Jan 2024 00:00:10 GMT": 10 * time.Second,
+		"Sun, 31 Dec 2023 00:00:00 GMT": 0,
+		"soon":                          defaultRetryAfter,
+		"86400":                         maxRetryAfter,
+		"Tue, 02 Jan 2024 00:00:00 GMT": maxRetryAfter,
+	}
+	for header, expected := range tests {
+		if got := retryAfter(header, now); got != expected {
+			t.Errorf("%q: expected %s, got %s", header, expected, got)
+		}
+	}
+}
+
+// the proxy retries requests the service refuses and slows us down
+func TestThrottleProxyRetry(t *testing.T) {
+
+	var calls atomic.Int32
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if calls.Add(1) <= 2 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(r.URL.Path + ":" + string(body)))
+	}))
+	defer service.Close()
+
+	objects := newRateLimiter(0)
+	endpoint, err := startThrottleProxy(service.URL+"/base", objects, newRateLimiter(0))
+	if err != nil {
+		t.Fatalf("starting proxy (%s)", err.Error())
+	}
+
+	resp, err := http.Post(endpoint+"/ns1", "application/json", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+	defer resp.Body.Close()
+	buf, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK || string(buf) != "/base/ns1:payload" {
+		t.Errorf("expected the retried request to succeed, got %d (%s)", resp.StatusCode, string(buf))
+	}
+	if calls.Load() != 3 {
+		t.Errorf("expected 3 calls, got %d", calls.Load())
+	}
+	if objects.factor() <= 1.0 {
+		t.Errorf("expected to be slowed down, got x%.1f", objects.factor())
+	}
+}
+
+// only requests that are safe to send again are retried
+func TestThrottleProxyRetryable(t *testing.T) {
+
+	tests := []struct {
+		method string
+		status int
+		size   int
+		calls  int32
+	}{
+		{http.MethodPost, http.StatusTooManyRequests, 10, 2},
+		{http.MethodPost, http.StatusServiceUnavailable, 10, 1},
+		{http.MethodPut, http.StatusServiceUnavailable, 10, 1},
+		{http.MethodDelete, http.StatusServiceUnavailable, 0, 1},
+		{http.MethodGet, http.StatusServiceUnavailable, 0, 2},
+		{http.MethodPost, http.StatusTooManyRequests, maxRetryBody + 1, 1},
+	}
+
+	for _, test := range tests {
+		var calls atomic.Int32
+		var received atomic.Int64
+		service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n, _ := io.Copy(io.Discard, r.Body)
+			received.Store(n)
+			if calls.Add(1) == 1 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(test.status)
+				return
+			}
+		}))
+
+		endpoint, err := startThrottleProxy(service.URL, newRateLimiter(0), newRateLimiter(0))
+		if err != nil {
+			t.Fatalf("starting proxy (%s)", err.Error())
+		}
+		req, _ := http.NewRequest(test.method, endpoint+"/ns1", strings.NewReader(strings.Repeat("x", test.size)))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %d: unexpected error (%s)", test.method, test.status, err.Error())
+		}
+		resp.Body.Close()
+		service.Close()
+
+		if calls.Load() != test.calls {
+			t.Errorf("%s %d (%d bytes): expected %d calls, got %d", test.method, test.status, test.size, test.calls, calls.Load())
+		}
+		if received.Load() != int64(test.size) {
+			t.Errorf("%s %d: expected the service to receive %d bytes, got %d", test.method, test.status, test.size, received.Load())
+		}
+		expected := http.StatusOK
+		if test.calls == 1 {
+			expected = test.status
+		}
+		if resp.StatusCode != expected {
+			t.Errorf("%s %d: expected HTTP %d, got %d", test.method, test.status, expected, resp.StatusCode)
+		}
+	}
+}
+
+//
+// end of file
+//
@@ -0,0 +1,152 @@
+//
+// embargo policy, turns the source embargo details into the object visibility fields
+//
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// how we handle embargoes that have already expired
+var expiredEmbargoPolicies = []string{"keep", "release", "drop"}
+
+type embargoPolicy struct {
+	expired      string            // expired embargo handling (keep|release|drop)
+	maxYears     int               // maximum embargo length in years, 0 for no limit
+	visibilities map[string]string // source visibility -> libra visibility
+}
+
+// the result of applying the embargo policy
+type embargoDecision struct {
+	defaultVisibility string   // the current visibility
+	releaseDate       string   // embargo release date, empty if no embargo
+	releaseVisibility string   // visibility after the embargo is released
+	explanation       []string // how we got here
+}
+
+// create a new embargo policy, the visibility mapping is of the form "from=to,from=to"
+func newEmbargoPolicy(expired string, maxYears int, visibilityMap string) (embargoPolicy, error) {
+
+	p := embargoPolicy{expired: expired, maxYears: maxYears, visibilities: make(map[string]string)}
+
+	if slices.Contains(expiredEmbargoPolicies, expired) == false {
+		return p, fmt.Errorf("unsupported expired embargo policy (%s)", expired)
+	}
+
+	if maxYears < 0 {
+		return p, fmt.Errorf("bad maximum embargo length (%d)", maxYears)
+	}
+
+	for _, m := range strings.Split(visibilityMap, ",") {
+		m = strings.TrimSpace(m)
+		if len(m) == 0 {
+			continue
+		}
+		from, to, found := strings.Cut(m, "=")
+		if found == false || len(strings.TrimSpace(from)) == 0 || len(strings.TrimSpace(to)) == 0 {
+			return p, fmt.Errorf("bad visibility mapping (%s)", m)
+		}
+		p.visibilities[strings.TrimSpace(from)] = strings.TrimSpace(to)
+	}
+	return p, nil
+}
+
+// apply the policy to the source visibility and embargo details, embargo decisions are made
+// relative to the supplied reference time
+func (p embargoPolicy) apply(defaultVis string, details EmbargoDetails, asOf time.Time) embargoDecision {
+
+	d := embargoDecision{explanation: make([]string, 0)}
+	d.defaultVisibility = p.mapVisibility(defaultVis, &d)
+
+	if len(details.ReleaseDate) == 0 {
+		return d
+	}
+
+	release := cleanupDate(details.ReleaseDate)
+	if len(release) == 0 {
+		d.explain("embargo release date [%s] cannot be interpreted, ignoring embargo", details.ReleaseDate)
+		return d
+	}
+
+	during := details.VisibilityDuring
+	if len(during) == 0 {
+		during = defaultVis
+	}
+	during = p.mapVisibility(during, &d)
+
+	after := details.VisibilityAfter
+	if len(after) == 0 {
+		after = defaultVis
+	}
+	after = p.mapVisibility(after, &d)
+
+	// limit the length of the embargo if necessary
+	if p.maxYears != 0 {
+		limit := asOf.UTC().AddDate(p.maxYears, 0, 0)
+		if inTheFuture(release, limit) == true {
+			clamped := limit.Format("2006-01-02T15:04:05Z")
+			d.explain("embargo release %s exceeds %d year maximum, using %s", release, p.maxYears, clamped)
+			release = clamped
+		}
+	}
+
+	// the embargo is still active
+	if inTheFuture(release, asOf) == true {
+		if len(during) != 0 {
+			d.defaultVisibility = during
+		}
+		d.releaseDate = release
+		d.releaseVisibility = after
+		d.explain("embargoed until %s, visibility [%s] during and [%s] after", release, d.defaultVisibility, after)
+		return d
+	}
+
+	// the embargo has expired
+	switch p.expired {
+	case "keep":
+		d.releaseDate = release
+		d.releaseVisibility = after
+		d.explain("embargo expired %s, keeping visibility [%s]", release, d.defaultVisibility)
+	case "release":
+		d.releaseDate = release
+		d.releaseVisibility = after
+		if len(after) != 0 {
+			d.defaultVisibility = after
+		}
+		d.explain("embargo expired %s, released to visibility [%s]", release, d.defaultVisibility)
+	case "drop":
+		if len(after) != 0 {
+			d.defaultVisibility = after
+		}
+		d.explain("embargo expired %s, dropped embargo and using visibility [%s]", release, d.defaultVisibility)
+	}
+	return d
+}
+
+// map a source visibility to the libra vocabulary
+func (p embargoPolicy) mapVisibility(vis string, d *embargoDecision) string {
+	mapped, found := p.visibilities[vis]
+	if found == true {
+		d.explain("visibility [%s] mapped to [%s]", vis, mapped)
+		return mapped
+	}
+	return vis
+}
+
+func (d *embargoDecision) explain(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	for _, e := range d.explanation {
+		if e == msg {
+			return
+		}
+	}
+	d.explanation = append(d.explanation, msg)
+}
+
+//
+// end of file
+//
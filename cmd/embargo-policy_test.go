@@ -0,0 +1,106 @@
+//
+// tests for the embargo policy
+//
+
+package main
+
+import (
+	"testing"
+)
+
+// the policy used if nothing else is specified
+func defaultEmbargoPolicy() embargoPolicy {
+	p, _ := newEmbargoPolicy("keep", 0, "authenticated=uva")
+	return p
+}
+
+func TestNewEmbargoPolicy(t *testing.T) {
+
+	tests := []struct {
+		expired  string
+		maxYears int
+		visMap   string
+		mapped   int
+		fail     bool
+	}{
+		{"keep", 0, "authenticated=uva", 1, false},
+		{"release", 5, " authenticated = uva , private=restricted ", 2, false},
+		{"drop", 0, "", 0, false},
+		{"drop", 0, "authenticated=uva,", 1, false},
+		{"forever", 0, "authenticated=uva", 0, true},
+		{"", 0, "authenticated=uva", 0, true},
+		{"keep", -1, "authenticated=uva", 0, true},
+		{"keep", 0, "authenticated", 0, true},
+		{"keep", 0, "=uva", 0, true},
+		{"keep", 0, "authenticated=", 0, true},
+	}
+
+	for _, test := range tests {
+		p, err := newEmbargoPolicy(test.expired, test.maxYears, test.visMap)
+		if (err != nil) != test.fail {
+			t.Errorf("newEmbargoPolicy(%q, %d, %q): unexpected error result (%v)", test.expired, test.maxYears, test.visMap, err)
+			continue
+		}
+		if test.fail == false && len(p.visibilities) != test.mapped {
+			t.Errorf("newEmbargoPolicy(%q, %d, %q): expected %d mappings, got %v", test.expired, test.maxYears, test.visMap, test.mapped, p.visibilities)
+		}
+	}
+}
+
+func TestEmbargoPolicyApply(t *testing.T) {
+
+	active := EmbargoDetails{VisibilityDuring: "restricted", VisibilityAfter: "open", ReleaseDate: "2030-01-01"}
+	expired := EmbargoDetails{VisibilityDuring: "restricted", VisibilityAfter: "open", ReleaseDate: "2020-06-01"}
+
+	tests := []struct {
+		name       string
+		expired    string
+		maxYears   int
+		defaultVis string
+		details    EmbargoDetails
+		visibility string
+		release    string
+		releaseVis string
+	}{
+		// no embargo
+		{"open", "keep", 0, "open", EmbargoDetails{}, "open", "", ""},
+		{"mapped", "keep", 0, "authenticated", EmbargoDetails{}, "uva", "", ""},
+		{"bad date", "keep", 0, "open", EmbargoDetails{VisibilityDuring: "restricted", ReleaseDate: "not a date"}, "open", "", ""},
+
+		// active embargo
+		{"active", "keep", 0, "open", active, "restricted", "2030-01-01T00:00:00Z", "open"},
+		{"active mapped", "keep", 0, "open", EmbargoDetails{VisibilityDuring: "authenticated", VisibilityAfter: "open", ReleaseDate: "2030-01-01"}, "uva", "2030-01-01T00:00:00Z", "open"},
+		{"active defaults", "keep", 0, "authenticated", EmbargoDetails{ReleaseDate: "2030-01-01"}, "uva", "2030-01-01T00:00:00Z", "uva"},
+		{"active drop", "drop", 0, "open", active, "restricted", "2030-01-01T00:00:00Z", "open"},
+
+		// clamped to the maximum length
+		{"clamped", "keep", 2, "open", active, "restricted", "2026-01-01T00:00:00Z", "open"},
+		{"within maximum", "keep", 10, "open", active, "restricted", "2030-01-01T00:00:00Z", "open"},
+
+		// expired embargo
+		{"expired keep", "keep", 0, "restricted", expired, "restricted", "2020-06-01T00:00:00Z", "open"},
+		{"expired release", "release", 0, "restricted", expired, "open", "2020-06-01T00:00:00Z", "open"},
+		{"expired drop", "drop", 0, "restricted", expired, "open", "", ""},
+		{"expired release mapped", "release", 0, "restricted", EmbargoDetails{VisibilityAfter: "authenticated", ReleaseDate: "2020-06-01"}, "uva", "2020-06-01T00:00:00Z", "uva"},
+		{"expired clamped", "drop", 2, "restricted", expired, "open", "", ""},
+	}
+
+	for _, test := range tests {
+		p, err := newEmbargoPolicy(test.expired, test.maxYears, "authenticated=uva")
+		if err != nil {
+			t.Fatalf("%s: unexpected error (%s)", test.name, err.Error())
+		}
+		d := p.apply(test.defaultVis, test.details, goldenAsOf)
+		if d.defaultVisibility != test.visibility || d.releaseDate != test.release || d.releaseVisibility != test.releaseVis {
+			t.Errorf("%s: got [%s] %q [%s], expected [%s] %q [%s]", test.name, d.defaultVisibility, d.releaseDate, d.releaseVisibility,
+				test.visibility, test.release, test.releaseVis)
+		}
+		if len(d.explanation) == 0 && test.defaultVis != test.visibility {
+			t.Errorf("%s: expected an explanation", test.name)
+		}
+	}
+}
+
+//
+// end of file
+//
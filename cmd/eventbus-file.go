@@ -0,0 +1,60 @@
+//
+// file sink implementation of the Libra bus interface, events are appended to a file
+// as JSON lines so they can be inspected (or replayed) without a bus
+//
+
+package main
+
+import (
+	"fmt"
+	"github.com/uvalib/librabus-sdk/uvalibrabus"
+	"os"
+	"sync"
+	"time"
+)
+
+type fileBus struct {
+	sync.Mutex
+	f *os.File // where the events are written
+}
+
+// create a new file sink, events are appended to any existing file contents
+func newFileBus(filename string) (*fileBus, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileBus{f: f}, nil
+}
+
+func (impl *fileBus) PublishEvent(event *uvalibrabus.UvaBusEvent) error {
+
+	// behave like the real bus
+	if len(event.EventName) == 0 {
+		return fmt.Errorf("%q: %w", "event name is blank", uvalibrabus.ErrBadParameter)
+	}
+	if len(event.EventTime) == 0 {
+		event.EventTime = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	buf, err := event.Serialize()
+	if err != nil {
+		return err
+	}
+
+	impl.Lock()
+	defer impl.Unlock()
+	_, err = impl.f.Write(append(buf, '\n'))
+	if err != nil {
+		return fmt.Errorf("%q: %w", err, uvalibrabus.ErrEventPublish)
+	}
+	return nil
+}
+
+func (impl *fileBus) close() error {
+	return impl.f.Close()
+}
+
+//
+// end of file
+//
@@ -0,0 +1,178 @@
+//
+// fileset metadata, the export fileset details (label, upload date, visibility and so on)
+// are kept alongside the files. Blobs have no metadata of their own so the details are
+// stored as a JSON array in the filesets field, in the original fileset order
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// how we handle private filesets
+var privateFilePolicies = []string{"skip", "include", "fail"}
+
+// the libra visibilities (after mapping), most visible first. Anything else is treated
+// as restricted
+var visibilityOrder = []string{"open", "uva", "restricted"}
+
+// a fileset as stored in the filesets field (a JSON array of these)
+type FilesetDetails struct {
+	Name                     string `json:"name"`                                 // the blob name
+	Label                    string `json:"label"`                                // display label
+	OriginalName             string `json:"original_name,omitempty"`              // the name the file was uploaded with
+	DateUploaded             string `json:"date_uploaded,omitempty"`              // YYYY-MM-DDTHH:MM:SSZ
+	Visibility               string `json:"visibility,omitempty"`                 // empty if the file has the work visibility
+	EmbargoRelease           string `json:"embargo_release,omitempty"`            // embargo release date, empty if no embargo
+	EmbargoReleaseVisibility string `json:"embargo_release_visibility,omitempty"` // visibility after the embargo is released
+	Representative           bool   `json:"representative,omitempty"`
+	Thumbnail                bool   `json:"thumbnail,omitempty"`
+	Order                    int    `json:"order"`  // position in the export (fileset number)
+	Source                   string `json:"source"` // the fileset file within the export
+}
+
+// the work references to its filesets
+type filesetReferences struct {
+	representative string // representative fileset id
+	thumbnail      string // thumbnail fileset id
+}
+
+// the fileset references from the work, a work we cannot read has none
+func loadFilesetReferences(indir string) filesetReferences {
+	refs := filesetReferences{}
+	buf, err := loadFile(fmt.Sprintf("%s/work.json", indir))
+	if err != nil {
+		return refs
+	}
+	work := EtdWorkJson{}
+	if err = decodeJson(buf, &work); err != nil {
+		return refs
+	}
+	refs.representative = work.RepresentativeId.value
+	refs.thumbnail = work.ThumbnailId.value
+	return refs
+}
+
+// the fileset details, the visibility and embargo go through the same policy as the work
+func makeFilesetDetails(fileset FilesetJson, name string, order int, source string, refs filesetReferences, opts importOptions, wr *workReport) FilesetDetails {
+
+	details := FilesetDetails{
+		Name:           name,
+		Label:          strings.TrimSpace(fileset.Label.value),
+		OriginalName:   strings.TrimSpace(fileset.OriginalName.value),
+		Representative: fileset.Representative.value,
+		Thumbnail:      fileset.Thumbnail.value,
+		Order:          order,
+		Source:         source,
+	}
+	if len(details.Label) == 0 {
+		details.Label = name
+	}
+	if len(fileset.DateUploaded.value) != 0 {
+		details.DateUploaded = interpretDate(fileset.DateUploaded.value)
+		if len(details.DateUploaded) == 0 {
+			wr.logWarning(fmt.Sprintf("%s date uploaded (%s) cannot be interpreted, ignoring", source, fileset.DateUploaded.value))
+		}
+	}
+	if len(fileset.Id.value) != 0 {
+		if fileset.Id.value == refs.representative {
+			details.Representative = true
+		}
+		if fileset.Id.value == refs.thumbnail {
+			details.Thumbnail = true
+		}
+	}
+
+	// files without their own visibility or embargo have the work visibility
+	embargo := filesetEmbargo(fileset)
+	if len(fileset.Visibility.value) == 0 && len(embargo.ReleaseDate) == 0 {
+		return details
+	}
+	decision := opts.embargo.apply(fileset.Visibility.value, embargo, opts.asOf)
+	details.Visibility = decision.defaultVisibility
+	details.EmbargoRelease = decision.releaseDate
+	details.EmbargoReleaseVisibility = decision.releaseVisibility
+	for _, e := range decision.explanation {
+		logInfo(fmt.Sprintf("%s %s", source, e))
+	}
+	return details
+}
+
+// the fileset embargo details, as for the work
+func filesetEmbargo(fileset FilesetJson) EmbargoDetails {
+	if fileset.Embargo.present == true {
+		return EmbargoDetails{
+			VisibilityDuring: fileset.Embargo.VisibilityDuring.value,
+			VisibilityAfter:  fileset.Embargo.VisibilityAfter.value,
+			ReleaseDate:      fileset.Embargo.ReleaseDate.value,
+		}
+	}
+	return EmbargoDetails{
+		VisibilityDuring: fileset.VisibilityDuringEmbargo.value,
+		VisibilityAfter:  fileset.VisibilityAfterEmbargo.value,
+		ReleaseDate:      fileset.EmbargoReleaseDate.value,
+	}
+}
+
+// a private file is currently less visible than its work will be (see mostVisible). File
+// embargoes are recorded but not enforced so an embargoed file is private until it is
+// released. A work without a visibility is treated as open
+func (d FilesetDetails) private(workVisibility string) bool {
+	if len(d.Visibility) == 0 {
+		return false
+	}
+	if len(workVisibility) == 0 {
+		workVisibility = visibilityOrder[0]
+	}
+	return visibilityRank(d.Visibility) > visibilityRank(workVisibility)
+}
+
+// the most visible state a work will reach, the more visible of its current visibility and
+// the visibility it has once any embargo is released. An empty work visibility is open
+func mostVisible(workVisibility string, releaseVisibility string) string {
+	if len(workVisibility) == 0 || len(releaseVisibility) == 0 {
+		return workVisibility
+	}
+	if visibilityRank(releaseVisibility) < visibilityRank(workVisibility) {
+		return releaseVisibility
+	}
+	return workVisibility
+}
+
+// the position of the visibility in the visibility order, unknown ones are the least visible
+func visibilityRank(visibility string) int {
+	ix := slices.Index(visibilityOrder, visibility)
+	if ix < 0 {
+		return len(visibilityOrder) - 1
+	}
+	return ix
+}
+
+// serialize the fileset details for the filesets field
+func makeFilesetsField(details []FilesetDetails) (string, error) {
+	buf, err := json.Marshal(details)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// the fileset details from the filesets field, an object without them has none
+func parseFilesetsField(str string) ([]FilesetDetails, error) {
+	details := make([]FilesetDetails, 0)
+	if len(str) == 0 {
+		return details, nil
+	}
+	if err := decodeJson([]byte(str), &details); err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+//
+// end of file
+//
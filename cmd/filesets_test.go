@@ -0,0 +1,147 @@
+//
+// tests for the fileset metadata
+//
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFilesetPrivate(t *testing.T) {
+
+	tests := []struct {
+		details  FilesetDetails
+		work     string
+		expected bool
+	}{
+		{FilesetDetails{}, "open", false},
+		{FilesetDetails{Visibility: "open"}, "open", false},
+		{FilesetDetails{Visibility: "open"}, "restricted", false},
+		{FilesetDetails{Visibility: "restricted"}, "open", true},
+		{FilesetDetails{Visibility: "restricted"}, "restricted", false},
+		{FilesetDetails{Visibility: "uva"}, "open", true},
+		{FilesetDetails{Visibility: "uva"}, "uva", false},
+		{FilesetDetails{Visibility: "uva"}, "", true},
+		{FilesetDetails{Visibility: "something"}, "uva", true},
+		{FilesetDetails{Visibility: "restricted", EmbargoRelease: "2030-01-01T00:00:00Z", EmbargoReleaseVisibility: "open"}, "open", true},
+		{FilesetDetails{Visibility: "restricted", EmbargoRelease: "2030-01-01T00:00:00Z", EmbargoReleaseVisibility: "open"}, "restricted", false},
+	}
+
+	for _, test := range tests {
+		if test.details.private(test.work) != test.expected {
+			t.Errorf("%+v in a [%s] work: expected private %t", test.details, test.work, test.expected)
+		}
+	}
+}
+
+func TestMostVisible(t *testing.T) {
+
+	tests := []struct {
+		work     string
+		release  string
+		expected string
+	}{
+		{"open", "", "open"},
+		{"restricted", "", "restricted"},
+		{"restricted", "open", "open"},
+		{"restricted", "uva", "uva"},
+		{"uva", "restricted", "uva"},
+		{"", "restricted", ""},
+	}
+
+	for _, test := range tests {
+		if got := mostVisible(test.work, test.release); got != test.expected {
+			t.Errorf("mostVisible(%q, %q) = %q, expected %q", test.work, test.release, got, test.expected)
+		}
+	}
+}
+
+func TestMakeFilesetDetails(t *testing.T) {
+
+	buf := []byte(`{"id": "fs-1", "title": ["file.pdf"], "date_uploaded": "not a date", "visibility": "authenticated",
+		"embargo_release_date": "2030-01-01", "visibility_after_embargo": "open"}`)
+	fileset, coercions, err := decodeFileset(buf)
+	if err != nil || len(coercions) != 0 {
+		t.Fatalf("unexpected coercions %v (%v)", coercions, err)
+	}
+
+	got := makeFilesetDetails(fileset, "file.pdf", 2, "work/fileset-2.json", filesetReferences{thumbnail: "fs-1"}, goldenOptions(), nil)
+	expected := FilesetDetails{Name: "file.pdf", Label: "file.pdf", Visibility: "uva", EmbargoRelease: "2030-01-01T00:00:00Z",
+		EmbargoReleaseVisibility: "open", Thumbnail: true, Order: 2, Source: "work/fileset-2.json"}
+	if got != expected {
+		t.Errorf("got %+v, expected %+v", got, expected)
+	}
+
+	// files without their own visibility have the work visibility
+	fileset, _, _ = decodeFileset([]byte(`{"title": ["file.pdf"], "label": " A File "}`))
+	got = makeFilesetDetails(fileset, "file.pdf", 1, "fileset-1.json", filesetReferences{}, goldenOptions(), nil)
+	if got.Label != "A File" || len(got.Visibility) != 0 || got.Representative == true {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestImportBlobsPrivateFiles(t *testing.T) {
+
+	dirname := filepath.Join(fixtureDir, "fileset-details")
+	opts := goldenOptions()
+
+	for _, test := range []struct {
+		policy string
+		files  int
+		fail   bool
+	}{
+		{"skip", 1, false},
+		{"include", 4, false},
+		{"fail", 0, true},
+	} {
+		opts.privateFiles = test.policy
+		blobs, filesets, err := importBlobs(goldenNamespace, dirname, "open", opts, nil)
+		if (err != nil) != test.fail {
+			t.Errorf("%s: unexpected error result (%v)", test.policy, err)
+			continue
+		}
+		if len(blobs) != test.files || len(filesets) != test.files {
+			t.Errorf("%s: expected %d files, got %d blobs and %d filesets", test.policy, test.files, len(blobs), len(filesets))
+			continue
+		}
+		// the fileset details follow the blobs and the export order
+		for ix, fs := range filesets {
+			if fs.Name != blobs[ix].Name() || (ix != 0 && fs.Order <= filesets[ix-1].Order) {
+				t.Errorf("%s: fileset %d out of order (%+v)", test.policy, ix, fs)
+			}
+		}
+		if test.policy == "include" && (filesets[1].Name != "interviews.txt" || filesets[1].Visibility != "restricted") {
+			t.Errorf("%s: expected the private file to be restricted, got %+v", test.policy, filesets[1])
+		}
+	}
+}
+
+func TestFilesetsField(t *testing.T) {
+
+	details := []FilesetDetails{{Name: "b.pdf", Label: "B", Order: 2, Source: "w/fileset-2.json"}, {Name: "a.pdf", Label: "A", Order: 3, Source: "w/fileset-3.json"}}
+	str, err := makeFilesetsField(details)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+	got, err := parseFilesetsField(str)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+	if len(got) != 2 || got[0] != details[0] || got[1] != details[1] {
+		t.Errorf("got %+v, expected %+v", got, details)
+	}
+
+	if got, err = parseFilesetsField(""); err != nil || len(got) != 0 {
+		t.Errorf("expected no details for an empty field, got %+v (%v)", got, err)
+	}
+	if _, err = parseFilesetsField("not json"); err == nil || strings.Contains(err.Error(), "invalid") == false {
+		t.Errorf("expected a decoding error, got %v", err)
+	}
+}
+
+//
+// end of file
+//
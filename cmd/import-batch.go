@@ -0,0 +1,117 @@
+//
+// batched object creation. The easystore API has no transactions so a batch is NOT atomic,
+// it is best effort with compensation: the objects in a batch are created concurrently and
+// if any of the creates fail the objects this run created are deleted again, including
+// those a failed create left behind part way. Objects that existed before the run are never
+// deleted. A delete that fails (or an object we cannot check) is reported as remaining. A
+// batch interrupted part way (killed, lost connection) leaves some of its objects behind,
+// and when the store publishes events (s3 and proxy modes) consumers see the create events
+// for the deleted objects followed by their delete events
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/uvalib/easystore/uvaeasystore"
+	"sync"
+)
+
+// a work waiting to be created
+type pendingWork struct {
+	dirname string                       // the work directory
+	obj     uvaeasystore.EasyStoreObject // the object to create
+	wr      *workReport                  // the work report
+}
+
+// what happened to a work in the batch
+type batchOutcome struct {
+	pendingWork
+	created uvaeasystore.EasyStoreObject // the created object (nil on error)
+	err     error                        // why it was not created
+	remains bool                         // the object was (or may have been) created and was not deleted again
+}
+
+// create the batch of objects concurrently. If any of them fail, the ones this run created
+// are deleted and every work in the batch is reported as an error. Objects we could not
+// delete are marked as remaining
+func createBatch(es uvaeasystore.EasyStore, batch []pendingWork) []batchOutcome {
+
+	outcomes := make([]batchOutcome, len(batch))
+	var wg sync.WaitGroup
+	for ix, pw := range batch {
+		outcomes[ix].pendingWork = pw
+		wg.Add(1)
+		go func(o *batchOutcome) {
+			defer wg.Done()
+			o.created, o.err = es.ObjectCreate(o.obj)
+		}(&outcomes[ix])
+	}
+	wg.Wait()
+
+	// did everything land
+	var cause error
+	for _, o := range outcomes {
+		if o.err != nil {
+			cause = fmt.Errorf("[%s] %s", o.obj.Id(), o.err.Error())
+			break
+		}
+	}
+	if cause == nil {
+		return outcomes
+	}
+
+	// compensate by deleting what we created, the failed creates keep their own error
+	if len(batch) > 1 {
+		logError(fmt.Sprintf("batch of %d failed (%s), deleting the objects it created", len(batch), cause.Error()))
+	}
+	for ix := len(outcomes) - 1; ix >= 0; ix-- {
+		o := &outcomes[ix]
+		if o.err != nil {
+			o.remains = deletePartial(es, o.obj)
+			continue
+		}
+		o.err = fmt.Errorf("batch failed, object deleted (%s)", cause.Error())
+		_, err := es.ObjectDelete(o.created, uvaeasystore.BaseComponent)
+		if err != nil {
+			logError(fmt.Sprintf("deleting ns/oid [%s/%s] from failed batch (%s), object remains", o.created.Namespace(), o.created.Id(), err.Error()))
+			o.err = fmt.Errorf("batch failed (%s) but the object could not be deleted and remains (%s)", cause.Error(), err.Error())
+			o.remains = true
+		}
+		o.created = nil
+	}
+	return outcomes
+}
+
+// a create that fails part way may leave the object behind, delete it if this run created
+// it. An object from before the run is left alone. Returns true if an object this run may
+// have created remains
+func deletePartial(es uvaeasystore.EasyStore, obj uvaeasystore.EasyStoreObject) bool {
+
+	existing, err := es.ObjectGetByKey(obj.Namespace(), obj.Id(), uvaeasystore.BaseComponent|uvaeasystore.Fields)
+	if errors.Is(err, uvaeasystore.ErrNotFound) == true {
+		return false
+	}
+	if err != nil {
+		logError(fmt.Sprintf("checking ns/oid [%s/%s] after a failed create (%s), object may remain", obj.Namespace(), obj.Id(), err.Error()))
+		return true
+	}
+
+	// the run that created the object is recorded with it
+	run := obj.Fields()[provenanceRun]
+	if len(run) == 0 || existing.Fields()[provenanceRun] != run {
+		return false
+	}
+
+	if _, err = es.ObjectDelete(existing, uvaeasystore.BaseComponent); err != nil {
+		logError(fmt.Sprintf("deleting ns/oid [%s/%s] after a failed create (%s), object remains", obj.Namespace(), obj.Id(), err.Error()))
+		return true
+	}
+	logInfo(fmt.Sprintf("deleted ns/oid [%s/%s] left behind by a failed create", obj.Namespace(), obj.Id()))
+	return false
+}
+
+//
+// end of file
+//
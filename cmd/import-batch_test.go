@@ -0,0 +1,164 @@
+//
+// tests for batched object creation
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/uvalib/easystore/uvaeasystore"
+	"testing"
+)
+
+// the run the batch objects are created by
+var batchRun = "batch-run"
+
+func makeBatch(ids ...string) []pendingWork {
+	batch := make([]pendingWork, 0, len(ids))
+	for _, id := range ids {
+		obj := uvaeasystore.NewEasyStoreObject("ns1", id)
+		obj.SetFields(uvaeasystore.EasyStoreObjectFields{provenanceRun: batchRun})
+		batch = append(batch, pendingWork{
+			dirname: fmt.Sprintf("export/%s", id),
+			obj:     obj,
+			wr:      &workReport{},
+		})
+	}
+	return batch
+}
+
+func TestCreateBatch(t *testing.T) {
+
+	es := newMemoryEasyStore()
+	for _, o := range createBatch(es, makeBatch("oid1", "oid2", "oid3")) {
+		if o.err != nil || o.created == nil {
+			t.Fatalf("%s: unexpected error (%v)", o.obj.Id(), o.err)
+		}
+	}
+	for _, id := range []string{"oid1", "oid2", "oid3"} {
+		if _, err := es.ObjectGetByKey("ns1", id, uvaeasystore.BaseComponent); err != nil {
+			t.Errorf("%s: expected object to exist (%s)", id, err.Error())
+		}
+	}
+}
+
+// one failure deletes the rest of the batch
+func TestCreateBatchCompensation(t *testing.T) {
+
+	es := newMemoryEasyStore()
+	_, err := es.ObjectCreate(uvaeasystore.NewEasyStoreObject("ns1", "oid2"))
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+
+	for _, o := range createBatch(es, makeBatch("oid1", "oid2", "oid3")) {
+		if o.err == nil || o.created != nil {
+			t.Errorf("%s: expected an error", o.obj.Id())
+		}
+		if o.obj.Id() == "oid2" && errors.Is(o.err, uvaeasystore.ErrAlreadyExists) == false {
+			t.Errorf("%s: expected the original error, got %v", o.obj.Id(), o.err)
+		}
+	}
+
+	for _, id := range []string{"oid1", "oid3"} {
+		_, err = es.ObjectGetByKey("ns1", id, uvaeasystore.BaseComponent)
+		if errors.Is(err, uvaeasystore.ErrNotFound) == false {
+			t.Errorf("%s: expected object to be deleted, got %v", id, err)
+		}
+	}
+
+	// the pre-existing object is untouched
+	if _, err = es.ObjectGetByKey("ns1", "oid2", uvaeasystore.BaseComponent); err != nil {
+		t.Errorf("expected existing object to remain (%s)", err.Error())
+	}
+}
+
+// a store whose deletes fail
+type failingDeleteStore struct {
+	uvaeasystore.EasyStore
+}
+
+func (s failingDeleteStore) ObjectDelete(obj uvaeasystore.EasyStoreObject, which uvaeasystore.EasyStoreComponents) (uvaeasystore.EasyStoreObject, error) {
+	return nil, fmt.Errorf("delete failed")
+}
+
+// objects we cannot delete are reported as remaining
+func TestCreateBatchCompensationFails(t *testing.T) {
+
+	es := failingDeleteStore{newMemoryEasyStore()}
+	_, err := es.ObjectCreate(uvaeasystore.NewEasyStoreObject("ns1", "oid2"))
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+
+	for _, o := range createBatch(es, makeBatch("oid1", "oid2", "oid3")) {
+		if o.err == nil || o.created != nil {
+			t.Errorf("%s: expected an error", o.obj.Id())
+		}
+		if o.remains != (o.obj.Id() != "oid2") {
+			t.Errorf("%s: unexpected remains %t (%v)", o.obj.Id(), o.remains, o.err)
+		}
+	}
+}
+
+// a store whose create of one object writes it and then fails (as when a file cannot be added)
+type partialCreateStore struct {
+	uvaeasystore.EasyStore
+	failId string
+}
+
+func (s partialCreateStore) ObjectCreate(obj uvaeasystore.EasyStoreObject) (uvaeasystore.EasyStoreObject, error) {
+	created, err := s.EasyStore.ObjectCreate(obj)
+	if err == nil && obj.Id() == s.failId {
+		return nil, fmt.Errorf("adding file failed")
+	}
+	return created, err
+}
+
+// the object a failed create left behind is deleted
+func TestCreateBatchPartialCreate(t *testing.T) {
+
+	mem := newMemoryEasyStore()
+	es := partialCreateStore{EasyStore: mem, failId: "oid2"}
+	for _, o := range createBatch(es, makeBatch("oid1", "oid2", "oid3")) {
+		if o.err == nil || o.created != nil || o.remains == true {
+			t.Errorf("%s: expected an error and nothing remaining (%v)", o.obj.Id(), o.err)
+		}
+	}
+	for _, id := range []string{"oid1", "oid2", "oid3"} {
+		if _, err := mem.ObjectGetByKey("ns1", id, uvaeasystore.BaseComponent); errors.Is(err, uvaeasystore.ErrNotFound) == false {
+			t.Errorf("%s: expected object to be deleted, got %v", id, err)
+		}
+	}
+
+	// an object from an earlier run is not ours to delete
+	mem = newMemoryEasyStore()
+	existing := uvaeasystore.NewEasyStoreObject("ns1", "oid2")
+	existing.SetFields(uvaeasystore.EasyStoreObjectFields{provenanceRun: "earlier-run"})
+	if _, err := mem.ObjectCreate(existing); err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+	for _, o := range createBatch(partialCreateStore{EasyStore: mem, failId: "oid1"}, makeBatch("oid1", "oid2")) {
+		if o.err == nil || o.remains == true {
+			t.Errorf("%s: expected an error and nothing remaining (%v)", o.obj.Id(), o.err)
+		}
+	}
+	if obj, err := mem.ObjectGetByKey("ns1", "oid2", uvaeasystore.Fields); err != nil || obj.Fields()[provenanceRun] != "earlier-run" {
+		t.Errorf("expected the existing object to remain (%v)", err)
+	}
+	if _, err := mem.ObjectGetByKey("ns1", "oid1", uvaeasystore.BaseComponent); errors.Is(err, uvaeasystore.ErrNotFound) == false {
+		t.Errorf("expected the partial object to be deleted, got %v", err)
+	}
+
+	// and one we cannot delete remains
+	for _, o := range createBatch(failingDeleteStore{partialCreateStore{EasyStore: newMemoryEasyStore(), failId: "oid1"}}, makeBatch("oid1")) {
+		if o.err == nil || o.remains == false {
+			t.Errorf("%s: expected the partial object to remain (%v)", o.obj.Id(), o.err)
+		}
+	}
+}
+
+//
+// end of file
+//
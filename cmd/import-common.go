@@ -35,16 +35,34 @@ type EmbargoDetails struct {
 }
 
 type importExtras struct {
-	adminNotes       []string
-	createDate       string
-	defaultVis       string // default visibility
-	depositor        string
-	doi              string
-	embargoRelease   string // embargo release date (if appropriate)
-	embargoVisDuring string // visibility during embargo
-	embargoVisAfter  string // visibility after embargo
-	pubDate          string
-	source           string
+	adminNotes  []string
+	createDate  string
+	defaultVis  string // default visibility
+	depositor   string
+	directory   string           // the work directory
+	diagnostics []workDiagnostic // problems found with the work metadata
+	doi         string
+	embargo     EmbargoDetails // embargo details (if appropriate)
+	pubDate     string
+	schema      string // the export schema
+	source      string
+	workHash    string // hash of the export work.json
+	workId      string // the work identifier in the export
+}
+
+// options that affect how we build objects
+type importOptions struct {
+	excludeFiles bool              // do not import files
+	embargo      embargoPolicy     // the embargo rules
+	diagnostics  diagnosticPolicy  // the diagnostics that fail a work
+	cleanup      textCleanup       // the text cleanup stages
+	language     string            // the language format (label|code|none)
+	languages    *languageTable    // the language table, nil to leave the language alone
+	vocabulary   *vocabulary       // the program and degree mapping, nil for none
+	related      *relatedUrlPolicy // the related URL handling, nil to leave them alone
+	privateFiles string            // private file handling (skip|include|fail)
+	run          importRun         // the run we are part of
+	asOf         time.Time         // reference time for any time dependent decisions
 }
 
 type ContributorSorter []LocalContributorData
@@ -60,80 +78,106 @@ func standardObject(namespace string, indir string) (uvaeasystore.EasyStoreObjec
 		return nil, err
 	}
 
-	// convert to a map
-	omap, err := interfaceToMap(buf)
-	if err != nil {
+	work := EtdWorkJson{}
+	if err = decodeJson(buf, &work); err != nil {
 		return nil, err
 	}
 
-	id, err := extractString("id", omap["id"])
-	if err != nil {
-		return nil, err
+	if len(work.Id.value) == 0 {
+		return nil, fmt.Errorf("%q: %w", "id is missing", uvaeasystore.ErrDeserialize)
 	}
 
-	o := uvaeasystore.NewEasyStoreObject(namespace, id)
+	o := uvaeasystore.NewEasyStoreObject(namespace, work.Id.value)
 	return o, nil
 }
 
-func importBlobs(namespace string, indir string) ([]uvaeasystore.EasyStoreBlob, error) {
+// import the files for the work along with their fileset details, in fileset order. Files
+// less visible than the work are handled according to the private file policy
+func importBlobs(namespace string, indir string, visibility string, opts importOptions, wr *workReport) ([]uvaeasystore.EasyStoreBlob, []FilesetDetails, error) {
 	blobs := make([]uvaeasystore.EasyStoreBlob, 0)
-	ix := 1
+	details := make([]FilesetDetails, 0)
+	refs := loadFilesetReferences(indir)
 	var blob uvaeasystore.EasyStoreBlob
-	exists := fileExists(fmt.Sprintf("%s/fileset-%d.json", indir, ix))
-	for exists == true {
+	for ix := 1; fileExists(fmt.Sprintf("%s/fileset-%d.json", indir, ix)) == true; ix++ {
 
 		// load the blob content
-		buf, err := loadFile(fmt.Sprintf("%s/fileset-%d.json", indir, ix))
+		filename := fmt.Sprintf("%s/fileset-%d.json", indir, ix)
+		buf, err := loadFile(filename)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
-		// extract the blob filename
-		fname := extractName(buf)
+		// extract the fileset details
+		fileset, coercions, err := decodeFileset(buf)
+		if err != nil {
+			return nil, nil, fmt.Errorf("fileset-%d.json: %w", ix, err)
+		}
+		for _, c := range coercions {
+			wr.logWarning(fmt.Sprintf("fileset-%d.json %s", ix, c))
+		}
+		fname := fileset.Title.first()
 
 		// some cases where we have bad files
-		if len(fname) != 0 {
-
-			// other cases where we have multiple references to the same file
-			if blobExists(blobs, fname) == false {
-				blob, err = loadBlob(indir, fname)
-				if err == nil {
-					pl, _ := blob.Payload()
-					logInfo(fmt.Sprintf("file %s (%d bytes)", blob.Name(), len(pl)))
-					// and add to the list
-					blobs = append(blobs, blob)
-				} else {
-					if errors.Is(err, os.ErrNotExist) {
-						logWarning(fmt.Sprintf("file not found (%s/%s), skipping", indir, fname))
-					} else {
-						return nil, err
-					}
-				}
-			} else {
-				logWarning(fmt.Sprintf("duplicate blob name, skipping"))
+		if len(fname) == 0 {
+			wr.logWarning(fmt.Sprintf("bad/empty blob name, skipping"))
+			continue
+		}
+
+		// other cases where we have multiple references to the same file
+		if blobExists(blobs, fname) == true {
+			wr.logWarning(fmt.Sprintf("duplicate blob name, skipping"))
+			continue
+		}
+
+		// private files are not published with the work unless we are told to
+		fs := makeFilesetDetails(fileset, strings.TrimSpace(fname), ix, relativePath(opts.run.root, filename), refs, opts, wr)
+		if fs.private(visibility) == true {
+			switch opts.privateFiles {
+			case "include":
+				wr.logWarning(fmt.Sprintf("private file (%s), including it with visibility [%s] in a [%s] work", fname, fs.Visibility, visibility))
+			case "fail":
+				return nil, nil, fmt.Errorf("private file (%s)", fname)
+			default:
+				wr.logWarning(fmt.Sprintf("private file (%s), skipping", fname))
+				continue
+			}
+		}
+
+		blob, err = loadBlob(indir, fname)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				wr.logWarning(fmt.Sprintf("file not found (%s/%s), skipping", indir, fname))
+				continue
 			}
-		} else {
-			logWarning(fmt.Sprintf("bad/empty blob name, skipping"))
+			return nil, nil, err
 		}
-		ix++
-		exists = fileExists(fmt.Sprintf("%s/fileset-%d.json", indir, ix))
+		pl, _ := blob.Payload()
+		logInfo(fmt.Sprintf("file %s (%d bytes)", blob.Name(), len(pl)))
+
+		// and add to the list
+		blobs = append(blobs, blob)
+		details = append(details, fs)
 	}
-	return blobs, nil
+	return blobs, details, nil
 }
 
-func extractName(i interface{}) string {
+// decode the fileset, returns the fileset and any coercions made
+func decodeFileset(buf []byte) (FilesetJson, []string, error) {
 
-	// convert to a map
-	omap, err := interfaceToMap(i)
-	if err != nil {
-		return ""
+	fileset := FilesetJson{}
+	if err := decodeJson(buf, &fileset); err != nil {
+		return FilesetJson{}, nil, err
 	}
+	return fileset, findCoercions(fileset), nil
+}
 
-	name, err := extractFirstString("title", omap["title"])
+// extract the file name from the fileset, returns the name and any coercions made
+func extractName(buf []byte) (string, []string, error) {
+	fileset, coercions, err := decodeFileset(buf)
 	if err != nil {
-		return ""
+		return "", nil, err
 	}
-	return name
+	return fileset.Title.first(), coercions, nil
 }
 
 func loadBlob(indir string, name string) (uvaeasystore.EasyStoreBlob, error) {
@@ -163,7 +207,7 @@ func blobExists(blobs []uvaeasystore.EasyStoreBlob, name string) bool {
 }
 
 func loadFile(filename string) ([]byte, error) {
-	buf, err := os.ReadFile(filename)
+	buf, err := inputSource.readFile(filename)
 	if err != nil {
 		return nil, err
 	}
@@ -171,8 +215,7 @@ func loadFile(filename string) ([]byte, error) {
 }
 
 func fileExists(filename string) bool {
-	_, err := os.Stat(filename)
-	return err == nil || errors.Is(err, os.ErrNotExist) == false
+	return inputSource.exists(filename)
 }
 
 func interfaceToMap(i interface{}) (map[string]interface{}, error) {
@@ -192,43 +235,8 @@ func interfaceToMap(i interface{}) (map[string]interface{}, error) {
 	return objmap, nil
 }
 
-func extractFirstString(name string, i interface{}) (string, error) {
-	fields, err := extractStringArray(name, i)
-	if err != nil {
-		return "", err
-	}
-	if len(fields) == 0 {
-		return "", nil
-	}
-	return fields[0], nil
-}
-
-func extractStringArray(name string, i interface{}) ([]string, error) {
-	result := make([]string, 0)
-	fields, ok := i.([]interface{})
-	if ok != true {
-		return result, fmt.Errorf("%q: %w", fmt.Sprintf("%s is not an array", name), uvaeasystore.ErrDeserialize)
-	}
-	for _, f := range fields {
-		field, ok := f.(string)
-		if ok != true {
-			return result, fmt.Errorf("%q: %w", fmt.Sprintf("%s array element is not a string", name), uvaeasystore.ErrDeserialize)
-		}
-		result = append(result, field)
-	}
-	return result, nil
-}
-
-func extractString(name string, i interface{}) (string, error) {
-	field, ok := i.(string)
-	if ok != true {
-		return "", fmt.Errorf("%q: %w", fmt.Sprintf("%s is not a string", name), uvaeasystore.ErrDeserialize)
-	}
-	return field, nil
-}
-
-// take a cleaned-up embargo date and determine if it is in the future
-func inTheFuture(datetime string) bool {
+// take a cleaned-up embargo date and determine if it is after the reference time
+func inTheFuture(datetime string, reference time.Time) bool {
 	if len(datetime) == 0 {
 		return false
 	}
@@ -240,11 +248,20 @@ func inTheFuture(datetime string) bool {
 		return false
 	}
 
-	return dt.After(time.Now())
+	return dt.After(reference)
 }
 
-// attempt to clean up the date
+// attempt to clean up the date, dates we cannot interpret are logged and set empty
 func cleanupDate(date string) string {
+	str := interpretDate(date)
+	if len(str) == 0 {
+		logError(fmt.Sprintf("unable to interpret date [%s], setting empty", date))
+	}
+	return str
+}
+
+// attempt to interpret the date, empty if we cannot
+func interpretDate(date string) string {
 
 	// remove periods, commas and a trailing 'th' on the date
 	clean := strings.Replace(date, ".", "", -1)
@@ -384,7 +401,6 @@ func cleanupDate(date string) string {
 		return str
 	}
 
-	logError(fmt.Sprintf("unable to interpret date [%s], setting empty\n", date))
 	return ""
 }
 
@@ -0,0 +1,160 @@
+//
+// work diagnostics, the problems found with the export metadata of a work and the policy
+// that decides which of them fail the work
+//
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// diagnostic severities
+const (
+	diagMissingOptional = "missing-optional"
+	diagMissingRequired = "missing-required"
+	diagWrongType       = "wrong-type"
+)
+
+var diagnosticSeverities = []string{diagMissingOptional, diagMissingRequired, diagWrongType}
+
+// the work fields we cannot do without
+var requiredFields = []string{"id", "title", "author_first_name", "author_last_name", "department", "degree"}
+
+// the work fields we expect but can manage without
+var optionalFields = []string{"description", "keyword", "language", "rights", "contributor",
+	"date_created", "date_published", "depositor", "author_email", "permanent_url"}
+
+// a problem found with a work field
+type workDiagnostic struct {
+	Field    string `json:"field"`             // the JSON name of the field
+	Severity string `json:"severity"`          // how bad it is
+	Message  string `json:"message,omitempty"` // the detail (for wrong types)
+}
+
+func (d workDiagnostic) String() string {
+	if len(d.Message) == 0 {
+		return fmt.Sprintf("%s: %s", d.Field, d.Severity)
+	}
+	return fmt.Sprintf("%s: %s (%s)", d.Field, d.Severity, d.Message)
+}
+
+// implemented by the lenient types, is the value missing or empty
+type emptiable interface {
+	empty() bool
+}
+
+// the diagnostic severities that fail a work
+type diagnosticPolicy struct {
+	failOn []string
+}
+
+// create a diagnostic policy from a list of severities (sev,sev) or none
+func newDiagnosticPolicy(str string) (diagnosticPolicy, error) {
+	p := diagnosticPolicy{failOn: make([]string, 0)}
+	if str == "none" || len(str) == 0 {
+		return p, nil
+	}
+	for _, s := range strings.Split(str, ",") {
+		s = strings.TrimSpace(s)
+		if slices.Contains(diagnosticSeverities, s) == false {
+			return p, fmt.Errorf("unsupported diagnostic severity (%s)", s)
+		}
+		p.failOn = append(p.failOn, s)
+	}
+	return p, nil
+}
+
+// check the diagnostics against the policy, returns an error describing the first
+// diagnostic that fails the work
+func (p diagnosticPolicy) check(diagnostics []workDiagnostic) error {
+	for _, d := range diagnostics {
+		if slices.Contains(p.failOn, d.Severity) == true {
+			return fmt.Errorf("work metadata diagnostic (%s)", d)
+		}
+	}
+	return nil
+}
+
+// diagnose the decoded work, missing fields followed by the values of the wrong type
+func diagnoseWork(work interface{}) []workDiagnostic {
+
+	result := make([]workDiagnostic, 0)
+	empty := emptyFields(reflect.ValueOf(work))
+	for _, name := range requiredFields {
+		if missing, found := empty[name]; found == true && missing == true {
+			result = append(result, workDiagnostic{Field: name, Severity: diagMissingRequired})
+		}
+	}
+	for _, name := range optionalFields {
+		if missing, found := empty[name]; found == true && missing == true {
+			result = append(result, workDiagnostic{Field: name, Severity: diagMissingOptional})
+		}
+	}
+
+	for _, c := range findCoercions(work) {
+		field, message, _ := strings.Cut(c, ": ")
+		result = append(result, workDiagnostic{Field: field, Severity: diagWrongType, Message: message})
+	}
+	return result
+}
+
+// the top level fields of the decoded structure and whether each is empty
+func emptyFields(v reflect.Value) map[string]bool {
+
+	result := make(map[string]bool)
+	for ix := 0; ix < v.NumField(); ix++ {
+		field := v.Type().Field(ix)
+		if field.IsExported() == false {
+			continue
+		}
+		if field.Anonymous == true {
+			for k, e := range emptyFields(v.Field(ix)) {
+				result[k] = e
+			}
+			continue
+		}
+		if e, ok := v.Field(ix).Interface().(emptiable); ok == true {
+			result[jsonName("", field)] = e.empty()
+		}
+	}
+	return result
+}
+
+// log the diagnostics, missing optional fields are common so they are only debug while
+// missing required fields and fields of the wrong type are always errors
+func logDiagnostics(diagnostics []workDiagnostic) {
+	for _, d := range diagnostics {
+		switch d.Severity {
+		case diagMissingOptional:
+			logDebug(d.String())
+		case diagMissingRequired, diagWrongType:
+			logError(d.String())
+		default:
+			logWarning(d.String())
+		}
+	}
+}
+
+// count the diagnostics by severity
+func countDiagnostics(counts map[string]int, diagnostics []workDiagnostic) {
+	for _, d := range diagnostics {
+		counts[d.Severity]++
+	}
+}
+
+// a summary of the diagnostic counts for logging
+func summarizeDiagnostics(counts map[string]int) string {
+	parts := make([]string, 0, len(diagnosticSeverities))
+	for _, s := range diagnosticSeverities {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[s], s))
+	}
+	return strings.Join(parts, ", ")
+}
+
+//
+// end of file
+//
@@ -0,0 +1,110 @@
+//
+// tests for the work diagnostics
+//
+
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDiagnoseWork(t *testing.T) {
+
+	work := HyraxWorkJson{}
+	buf := `{"id": "abc", "title": [""], "author_first_name": "A", "author_last_name": "B",
+		"department": "English", "degree": {"name": "PHD"}, "description": "d", "keyword": "k",
+		"language": "English", "rights": ["r"], "contributor": [], "date_created": "2020",
+		"date_published": "2020", "depositor": "a", "author_email": "a@b", "permanent_url": "doi"}`
+	if err := decodeJson([]byte(buf), &work); err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+
+	expected := []string{
+		"title: missing-required",
+		"degree: missing-required",
+		"contributor: missing-optional",
+		"degree: wrong-type (object where a string was expected, ignoring)",
+		"keyword: wrong-type (single value where an array was expected)",
+	}
+	found := make([]string, 0)
+	for _, d := range diagnoseWork(work) {
+		found = append(found, d.String())
+	}
+	if slices.Equal(found, expected) == false {
+		t.Errorf("expected %q, got %q", expected, found)
+	}
+}
+
+func TestDiagnosticPolicy(t *testing.T) {
+
+	for _, str := range []string{"", "none", "wrong-type", "missing-required, missing-optional"} {
+		if _, err := newDiagnosticPolicy(str); err != nil {
+			t.Errorf("%q: unexpected error (%s)", str, err.Error())
+		}
+	}
+	if _, err := newDiagnosticPolicy("missing"); err == nil {
+		t.Errorf("expected an error for an unsupported severity")
+	}
+
+	diagnostics := []workDiagnostic{{Field: "keyword", Severity: diagMissingOptional}, {Field: "notes", Severity: diagWrongType}}
+	none, _ := newDiagnosticPolicy("none")
+	if err := none.check(diagnostics); err != nil {
+		t.Errorf("expected no failure, got %s", err.Error())
+	}
+	required, _ := newDiagnosticPolicy("missing-required")
+	if err := required.check(diagnostics); err != nil {
+		t.Errorf("expected no failure, got %s", err.Error())
+	}
+	wrongType, _ := newDiagnosticPolicy("wrong-type")
+	if err := wrongType.check(diagnostics); err == nil {
+		t.Errorf("expected the wrong type to fail the work")
+	}
+}
+
+func TestDiagnosticFailure(t *testing.T) {
+
+	opts := goldenOptions()
+	opts.diagnostics, _ = newDiagnosticPolicy("wrong-type")
+	wr := &workReport{}
+	_, err := makeEtdObject(goldenNamespace, filepath.Join(fixtureDir, "coerced-types"), opts, wr)
+	if err == nil {
+		t.Fatalf("expected the work to fail")
+	}
+	if len(wr.Diagnostics) == 0 {
+		t.Errorf("expected the diagnostics to be reported")
+	}
+
+	report := newRunReport(false, goldenAsOf)
+	report.Works = append(report.Works, wr)
+	report.finish(0, 0, 1)
+	if report.Diagnostics[diagWrongType] != len(wr.Diagnostics) || report.Diagnostics[diagMissingRequired] != 0 {
+		t.Errorf("unexpected diagnostic counts %v", report.Diagnostics)
+	}
+}
+
+// a work without a title is a missing required field, not a schema error
+func TestDiagnosticMissingTitle(t *testing.T) {
+
+	opts := goldenOptions()
+	dirname := filepath.Join(fixtureDir, "missing-title")
+	if _, err := makeEtdObject(goldenNamespace, dirname, opts, &workReport{}); err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+
+	opts.diagnostics, _ = newDiagnosticPolicy("missing-required")
+	wr := &workReport{}
+	_, err := makeEtdObject(goldenNamespace, dirname, opts, wr)
+	if err == nil || strings.Contains(err.Error(), "title") == false {
+		t.Fatalf("expected the missing title to fail the work, got %v", err)
+	}
+	if len(wr.Diagnostics) != 1 || wr.Diagnostics[0].Field != "title" || wr.Diagnostics[0].Severity != diagMissingRequired {
+		t.Errorf("unexpected diagnostics %v", wr.Diagnostics)
+	}
+}
+
+//
+// end of file
+//
@@ -0,0 +1,320 @@
+//
+// diff mode, shows what a re-import would change by comparing the object built from the
+// export with the version currently in the store
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/uvalib/easystore/uvaeasystore"
+	"io"
+	"slices"
+	"sort"
+)
+
+// the diff output formats
+var diffFormats = []string{"text", "json"}
+
+// diff status values
+const (
+	diffNew       = "new" // not in the store
+	diffChanged   = "changed"
+	diffUnchanged = "unchanged"
+	diffError     = "error"
+)
+
+// file change values
+const (
+	fileAdded   = "added"
+	fileRemoved = "removed"
+	fileChanged = "changed"
+)
+
+// the differences for a work
+type workDiff struct {
+	Directory string         `json:"directory"`          // source directory
+	Id        string         `json:"id,omitempty"`       // work identifier
+	Status    string         `json:"status"`             // the overall status
+	Error     string         `json:"error,omitempty"`    // why we could not diff
+	Fields    []propertyDiff `json:"fields,omitempty"`   // changed fields
+	Metadata  []propertyDiff `json:"metadata,omitempty"` // changed metadata properties
+	Files     []fileDiff     `json:"files,omitempty"`    // changed files
+}
+
+// a changed value, metadata values are shown as JSON
+type propertyDiff struct {
+	Name   string `json:"name"`
+	Before string `json:"before"` // stored value
+	After  string `json:"after"`  // export value
+}
+
+type fileDiff struct {
+	Name   string `json:"name"`
+	Change string `json:"change"` // added, removed or changed
+}
+
+// diff each of the works below the import directory against the store and write the results
+func diffWorks(es uvaeasystore.EasyStore, namespace string, inDir string, opts importOptions, format string, w io.Writer) error {
+
+	dirs, _, err := findWorks(inDir)
+	if err != nil {
+		return err
+	}
+	opts.related.indexWorks(dirs)
+
+	diffs := make([]workDiff, 0, len(dirs))
+	for _, wo := range orderWorks(inDir, dirs, "name") {
+		diffs = append(diffs, diffWork(es, namespace, wo.dirname, opts))
+	}
+	return writeDiffs(w, diffs, format)
+}
+
+// diff a single work against the stored version
+func diffWork(es uvaeasystore.EasyStore, namespace string, dirname string, opts importOptions) workDiff {
+
+	wd := workDiff{Directory: dirname}
+	wr := &workReport{Directory: dirname}
+	obj, err := makeEtdObject(namespace, dirname, opts, wr)
+	wd.Id = wr.Id
+	if err != nil {
+		wd.Status = diffError
+		wd.Error = err.Error()
+		return wd
+	}
+
+	wd.Status = diffChanged
+	stored, err := es.ObjectGetByKey(obj.Namespace(), obj.Id(), uvaeasystore.AllComponents)
+	if err != nil {
+		if errors.Is(err, uvaeasystore.ErrNotFound) == false {
+			wd.Status = diffError
+			wd.Error = err.Error()
+			return wd
+		}
+		// compare against an empty object
+		wd.Status = diffNew
+		stored = uvaeasystore.NewEasyStoreObject(obj.Namespace(), obj.Id())
+	}
+
+	wd.Fields = diffFields(stored.Fields(), obj.Fields())
+	wd.Metadata, err = diffMetadata(stored.Metadata(), obj.Metadata())
+	if err != nil {
+		wd.Status = diffError
+		wd.Error = err.Error()
+		return wd
+	}
+	if opts.excludeFiles == false {
+		wd.Files = diffFiles(stored.Files(), obj.Files())
+	}
+
+	if wd.Status == diffChanged && len(wd.Fields) == 0 && len(wd.Metadata) == 0 && len(wd.Files) == 0 {
+		wd.Status = diffUnchanged
+	}
+	return wd
+}
+
+func diffFields(before uvaeasystore.EasyStoreObjectFields, after uvaeasystore.EasyStoreObjectFields) []propertyDiff {
+	names := make(map[string]bool)
+	for k := range before {
+		names[k] = true
+	}
+	for k := range after {
+		names[k] = true
+	}
+
+	diffs := make([]propertyDiff, 0)
+	for _, name := range sortedKeys(names) {
+		if slices.Contains(runSpecificFields, name) == true {
+			continue
+		}
+		if comparableField(name, before[name]) != comparableField(name, after[name]) {
+			diffs = append(diffs, propertyDiff{Name: name, Before: before[name], After: after[name]})
+		}
+	}
+	return diffs
+}
+
+// the field value used for comparison, the notes added by each import run are ignored
+func comparableField(name string, value string) string {
+	if name != "admin-notes" {
+		return value
+	}
+	var notes []AdminNote
+	if err := json.Unmarshal([]byte(value), &notes); err != nil {
+		return value
+	}
+	exported := make([]AdminNote, 0, len(notes))
+	for _, n := range notes {
+		if n.Source != noteSourceImport {
+			exported = append(exported, n)
+		}
+	}
+	buf, _ := json.Marshal(exported)
+	return string(buf)
+}
+
+// compare the top level metadata properties
+func diffMetadata(before uvaeasystore.EasyStoreMetadata, after uvaeasystore.EasyStoreMetadata) ([]propertyDiff, error) {
+	bmap, err := metadataProperties(before)
+	if err != nil {
+		return nil, fmt.Errorf("stored metadata (%s)", err.Error())
+	}
+	amap, err := metadataProperties(after)
+	if err != nil {
+		return nil, fmt.Errorf("export metadata (%s)", err.Error())
+	}
+
+	names := make(map[string]bool)
+	for k := range bmap {
+		names[k] = true
+	}
+	for k := range amap {
+		names[k] = true
+	}
+
+	diffs := make([]propertyDiff, 0)
+	for _, name := range sortedKeys(names) {
+		if bytes.Equal(bmap[name], amap[name]) == false {
+			diffs = append(diffs, propertyDiff{Name: name, Before: string(bmap[name]), After: string(amap[name])})
+		}
+	}
+	return diffs, nil
+}
+
+// the metadata properties as compact JSON, missing and empty values are treated the same
+func metadataProperties(md uvaeasystore.EasyStoreMetadata) (map[string][]byte, error) {
+	props := make(map[string][]byte)
+	if md == nil {
+		return props, nil
+	}
+	buf, err := md.Payload()
+	if err != nil || len(buf) == 0 {
+		return props, err
+	}
+
+	var omap map[string]any
+	if err = json.Unmarshal(buf, &omap); err != nil {
+		return nil, err
+	}
+	for k, v := range omap {
+		if isEmptyValue(v) == true {
+			continue
+		}
+		props[k], _ = json.Marshal(v)
+	}
+	return props, nil
+}
+
+func isEmptyValue(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case string:
+		return len(t) == 0
+	case []any:
+		return len(t) == 0
+	case map[string]any:
+		return len(t) == 0
+	}
+	return false
+}
+
+// compare files by name, the contents are compared when both are available
+func diffFiles(before []uvaeasystore.EasyStoreBlob, after []uvaeasystore.EasyStoreBlob) []fileDiff {
+	bmap := make(map[string]uvaeasystore.EasyStoreBlob)
+	for _, b := range before {
+		bmap[b.Name()] = b
+	}
+	amap := make(map[string]uvaeasystore.EasyStoreBlob)
+	for _, b := range after {
+		amap[b.Name()] = b
+	}
+
+	names := make(map[string]bool)
+	for k := range bmap {
+		names[k] = true
+	}
+	for k := range amap {
+		names[k] = true
+	}
+
+	diffs := make([]fileDiff, 0)
+	for _, name := range sortedKeys(names) {
+		b, inBefore := bmap[name]
+		a, inAfter := amap[name]
+		switch {
+		case inBefore == false:
+			diffs = append(diffs, fileDiff{Name: name, Change: fileAdded})
+		case inAfter == false:
+			diffs = append(diffs, fileDiff{Name: name, Change: fileRemoved})
+		case blobsDiffer(b, a) == true:
+			diffs = append(diffs, fileDiff{Name: name, Change: fileChanged})
+		}
+	}
+	return diffs
+}
+
+func blobsDiffer(before uvaeasystore.EasyStoreBlob, after uvaeasystore.EasyStoreBlob) bool {
+	if before.MimeType() != after.MimeType() {
+		return true
+	}
+	bbuf, berr := before.Payload()
+	abuf, aerr := after.Payload()
+	// some stores only provide a URL, we cannot compare those
+	if berr != nil || aerr != nil || len(bbuf) == 0 {
+		return false
+	}
+	return hashBytes(bbuf) != hashBytes(abuf)
+}
+
+func writeDiffs(w io.Writer, diffs []workDiff, format string) error {
+
+	if format == "json" {
+		buf, err := json.MarshalIndent(diffs, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(buf))
+		return err
+	}
+
+	for _, wd := range diffs {
+		fmt.Fprintf(w, "%s [%s]: %s\n", wd.Directory, wd.Id, wd.Status)
+		if len(wd.Error) != 0 {
+			fmt.Fprintf(w, "  error: %s\n", wd.Error)
+		}
+		for _, d := range wd.Fields {
+			fmt.Fprintf(w, "  field %s: %q -> %q\n", d.Name, d.Before, d.After)
+		}
+		for _, d := range wd.Metadata {
+			fmt.Fprintf(w, "  metadata %s: %s -> %s\n", d.Name, displayJson(d.Before), displayJson(d.After))
+		}
+		for _, d := range wd.Files {
+			fmt.Fprintf(w, "  file %s: %s\n", d.Name, d.Change)
+		}
+	}
+	return nil
+}
+
+func displayJson(str string) string {
+	if len(str) == 0 {
+		return "(none)"
+	}
+	return str
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//
+// end of file
+//
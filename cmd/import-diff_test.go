@@ -0,0 +1,123 @@
+//
+// tests for diff mode
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/uvalib/easystore/uvaeasystore"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDiffWork(t *testing.T) {
+
+	es := newMemoryEasyStore()
+	dirname := filepath.Join(fixtureDir, "basic")
+
+	// not yet in the store
+	wd := diffWork(es, goldenNamespace, dirname, goldenOptions())
+	if wd.Status != diffNew || len(wd.Fields) == 0 || len(wd.Files) == 0 {
+		t.Fatalf("expected a new work with fields and files, got %+v", wd)
+	}
+
+	// store it without files and with a different field value
+	opts := goldenOptions()
+	opts.excludeFiles = true
+	obj, err := makeEtdObject(goldenNamespace, dirname, opts, &workReport{})
+	if err != nil {
+		t.Fatalf("creating object (%s)", err.Error())
+	}
+	fields := obj.Fields()
+	fields["default-visibility"] = "restricted"
+	obj.SetFields(fields)
+	if _, err = es.ObjectCreate(obj); err != nil {
+		t.Fatalf("importing object (%s)", err.Error())
+	}
+
+	wd = diffWork(es, goldenNamespace, dirname, goldenOptions())
+	if wd.Status != diffChanged {
+		t.Fatalf("expected a changed work, got %+v", wd)
+	}
+	// the stored object has no files so no fileset details either
+	if len(wd.Fields) != 2 || wd.Fields[0].Name != "default-visibility" || wd.Fields[0].Before != "restricted" {
+		t.Errorf("expected the visibility to change, got %+v", wd.Fields)
+	}
+	if len(wd.Fields) == 2 && (wd.Fields[1].Name != "filesets" || len(wd.Fields[1].Before) != 0) {
+		t.Errorf("expected the fileset details to be added, got %+v", wd.Fields)
+	}
+	if len(wd.Metadata) != 0 {
+		t.Errorf("expected no metadata changes, got %+v", wd.Metadata)
+	}
+	if slices.Contains(wd.Files, fileDiff{Name: "thesis.pdf", Change: fileAdded}) == false {
+		t.Errorf("expected thesis.pdf to be added, got %+v", wd.Files)
+	}
+
+	// files are not compared when they are excluded
+	wd = diffWork(es, goldenNamespace, dirname, opts)
+	if wd.Status != diffChanged || len(wd.Fields) != 1 || len(wd.Files) != 0 {
+		t.Errorf("expected only the field change, got %+v", wd)
+	}
+
+	// a later run only adds a different import note, which is not a change
+	opts.run.id = "later-run"
+	opts.run.started = goldenAsOf.AddDate(0, 1, 0)
+	wd = diffWork(es, goldenNamespace, dirname, opts)
+	if len(wd.Fields) != 1 || wd.Fields[0].Name != "default-visibility" {
+		t.Errorf("expected the import note to be ignored, got %+v", wd.Fields)
+	}
+}
+
+func TestDiffMetadata(t *testing.T) {
+	before := uvaeasystore.NewEasyStoreMetadata("application/json", []byte(`{"title":"Old","keywords":["a"],"notes":""}`))
+	after := uvaeasystore.NewEasyStoreMetadata("application/json", []byte(`{"title":"New","keywords":["a"],"language":"English"}`))
+
+	diffs, err := diffMetadata(before, after)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+	expected := []propertyDiff{
+		{Name: "language", Before: "", After: `"English"`},
+		{Name: "title", Before: `"Old"`, After: `"New"`},
+	}
+	if slices.Equal(diffs, expected) == false {
+		t.Errorf("expected %+v, got %+v", expected, diffs)
+	}
+}
+
+func TestWriteDiffs(t *testing.T) {
+	diffs := []workDiff{{
+		Directory: "export/basic",
+		Id:        "etd-basic-0001",
+		Status:    diffChanged,
+		Metadata:  []propertyDiff{{Name: "title", Before: `"Old"`, After: `"New"`}},
+		Files:     []fileDiff{{Name: "thesis.pdf", Change: fileRemoved}},
+	}}
+
+	var text bytes.Buffer
+	if err := writeDiffs(&text, diffs, "text"); err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+	for _, line := range []string{"export/basic [etd-basic-0001]: changed", `metadata title: "Old" -> "New"`, "file thesis.pdf: removed"} {
+		if strings.Contains(text.String(), line) == false {
+			t.Errorf("expected %q in %q", line, text.String())
+		}
+	}
+
+	var js bytes.Buffer
+	if err := writeDiffs(&js, diffs, "json"); err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+	var decoded []workDiff
+	if err := json.Unmarshal(js.Bytes(), &decoded); err != nil || len(decoded) != 1 || decoded[0].Id != "etd-basic-0001" {
+		t.Errorf("unexpected JSON output %s (%v)", js.String(), err)
+	}
+}
+
+//
+// end of file
+//
@@ -0,0 +1,346 @@
+//
+// cross-work duplicate detection
+//
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/uvalib/easystore/uvaeasystore"
+	"golang.org/x/text/unicode/norm"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// the duplicate handling policies
+var duplicatePolicies = []string{"none", "report", "skip", "merge", "fail"}
+
+// summary details used to identify duplicate works
+type workSummary struct {
+	dirname     string   // the work directory
+	id          string   // work identifier
+	doi         string   // cleaned up DOI (if any)
+	titleAuthor string   // normalized title and author
+	hashes      []string // file hashes (sorted, without repeats)
+}
+
+// a work that duplicates an earlier one
+type duplicateWork struct {
+	primary string   // the directory of the primary (first seen) work
+	reasons []string // why we consider this a duplicate
+}
+
+type duplicateIndex struct {
+	works       []workSummary            // all the works we indexed
+	duplicates  map[string]duplicateWork // secondary directory -> duplicate details
+	secondaries map[string][]string      // primary directory -> secondary directories
+	nearDups    map[string][]string      // file hash -> directories
+}
+
+// index the supplied work directories and identify any duplicates. Works are considered
+// duplicates when they share an id, a DOI, a title and author or all of their files. Works
+// that share some of their files are reported as near duplicates.
+func indexDuplicates(dirs []string) *duplicateIndex {
+
+	index := duplicateIndex{
+		works:       make([]workSummary, 0, len(dirs)),
+		duplicates:  make(map[string]duplicateWork),
+		secondaries: make(map[string][]string),
+		nearDups:    make(map[string][]string),
+	}
+
+	// key (id, DOI, title and author, file set) -> directory that first used it
+	seen := make(map[string]string)
+
+	for _, dirname := range dirs {
+		ws, err := summarizeWork(dirname)
+		if err != nil {
+			logWarning(fmt.Sprintf("unable to index %s for duplicates (%s), ignoring", dirname, err.Error()))
+			continue
+		}
+		index.works = append(index.works, ws)
+
+		keys := make([]string, 0)
+		if len(ws.id) != 0 {
+			keys = append(keys, fmt.Sprintf("id:%s", ws.id))
+		}
+		if len(ws.doi) != 0 {
+			keys = append(keys, fmt.Sprintf("doi:%s", ws.doi))
+		}
+		if len(ws.titleAuthor) != 0 {
+			keys = append(keys, fmt.Sprintf("title/author:%s", ws.titleAuthor))
+		}
+		if len(ws.hashes) != 0 {
+			keys = append(keys, fmt.Sprintf("files:%s", hashBytes([]byte(strings.Join(ws.hashes, ",")))))
+		}
+
+		// have we seen any of these before
+		primary := ""
+		reasons := make([]string, 0)
+		for _, k := range keys {
+			first, found := seen[k]
+			if found == false {
+				seen[k] = dirname
+				continue
+			}
+
+			// always refer back to the primary work
+			if dup, isDup := index.duplicates[first]; isDup == true {
+				first = dup.primary
+			}
+			if len(primary) == 0 {
+				primary = first
+			}
+			reasons = append(reasons, fmt.Sprintf("same %s as %s", k, first))
+		}
+
+		if len(primary) != 0 {
+			index.duplicates[dirname] = duplicateWork{primary: primary, reasons: reasons}
+			index.secondaries[primary] = append(index.secondaries[primary], dirname)
+		}
+
+		for _, h := range ws.hashes {
+			index.nearDups[h] = append(index.nearDups[h], dirname)
+		}
+	}
+
+	return &index
+}
+
+// log the duplicates and near duplicates we found
+func (index *duplicateIndex) report() {
+
+	for _, ws := range index.works {
+		dup, found := index.duplicates[ws.dirname]
+		if found == true {
+			logWarning(fmt.Sprintf("duplicate work %s (%s)", ws.dirname, strings.Join(dup.reasons, ", ")))
+		}
+	}
+
+	// works sharing a file that are not already duplicates of each other, each group once
+	reported := make(map[string]bool)
+	for _, ws := range index.works {
+		for _, h := range ws.hashes {
+			dirs := index.nearDups[h]
+			if dirs[0] != ws.dirname || index.samePrimary(dirs) == true {
+				continue
+			}
+			group := strings.Join(dirs, ", ")
+			if reported[group] == false {
+				reported[group] = true
+				logWarning(fmt.Sprintf("possible duplicate works, sharing a file (%s)", group))
+			}
+		}
+	}
+
+	logAlways(fmt.Sprintf("indexed %d work(s), %d duplicate(s)", len(index.works), len(index.duplicates)))
+}
+
+// do the supplied works all refer back to the same primary work
+func (index *duplicateIndex) samePrimary(dirs []string) bool {
+	primary := index.primaryOf(dirs[0])
+	for _, d := range dirs[1:] {
+		if index.primaryOf(d) != primary {
+			return false
+		}
+	}
+	return true
+}
+
+// the primary work for the supplied directory, itself if it is not a duplicate
+func (index *duplicateIndex) primaryOf(dirname string) string {
+	if dup, found := index.duplicates[dirname]; found == true {
+		return dup.primary
+	}
+	return dirname
+}
+
+// the primary work could not be imported so the next of its duplicates (if any) takes its
+// place and becomes the primary for the remainder. Returns the new primary. Promotion is
+// local to this run, a duplicate owned by another shard is still skipped there
+func (index *duplicateIndex) promote(dirname string) string {
+	if index == nil {
+		return ""
+	}
+	secondaries := index.secondaries[dirname]
+	if len(secondaries) == 0 {
+		return ""
+	}
+	delete(index.secondaries, dirname)
+
+	primary := secondaries[0]
+	delete(index.duplicates, primary)
+	for _, d := range secondaries[1:] {
+		dup := index.duplicates[d]
+		dup.primary = primary
+		index.duplicates[d] = dup
+		index.secondaries[primary] = append(index.secondaries[primary], d)
+	}
+	return primary
+}
+
+// the number of duplicate works found
+func (index *duplicateIndex) duplicateCount() int {
+	return len(index.duplicates)
+}
+
+// is the supplied directory a duplicate of an earlier work
+func (index *duplicateIndex) isDuplicate(dirname string) bool {
+	_, found := index.duplicates[dirname]
+	return found
+}
+
+// merge files from any duplicates of this work into the object, files already present
+// (by content) are ignored. The fileset details of the merged files are added to the
+// existing ones
+func (index *duplicateIndex) mergeDuplicates(obj uvaeasystore.EasyStoreObject, dirname string, opts importOptions, wr *workReport) error {
+
+	secondaries := index.secondaries[dirname]
+	if len(secondaries) == 0 {
+		return nil
+	}
+
+	blobs := obj.Files()
+	hashes := make(map[string]bool)
+	for _, b := range blobs {
+		pl, _ := b.Payload()
+		hashes[hashBytes(pl)] = true
+	}
+
+	fields := obj.Fields()
+	filesets, err := parseFilesetsField(fields["filesets"])
+	if err != nil {
+		return err
+	}
+
+	// the merged files are compared with the most visible state of the work
+	visibility := mostVisible(fields["default-visibility"], fields["embargo-release-visibility"])
+	merged := 0
+	for _, dup := range secondaries {
+		dupBlobs, dupFilesets, err := importBlobs(obj.Namespace(), dup, visibility, opts, wr)
+		if err != nil {
+			return err
+		}
+		for ix, b := range dupBlobs {
+			pl, _ := b.Payload()
+			h := hashBytes(pl)
+			if hashes[h] == true {
+				continue
+			}
+			if blobExists(blobs, b.Name()) == true {
+				wr.logWarning(fmt.Sprintf("duplicate blob name merging from %s (%s), skipping", dup, b.Name()))
+				continue
+			}
+			hashes[h] = true
+			blobs = append(blobs, b)
+			filesets = append(filesets, dupFilesets[ix])
+			merged++
+		}
+	}
+
+	if merged != 0 {
+		fields["filesets"], err = makeFilesetsField(filesets)
+		if err != nil {
+			return err
+		}
+		obj.SetFields(fields)
+		obj.SetFiles(blobs)
+		logInfo(fmt.Sprintf("merged %d file(s) from %d duplicate(s) into [%s]", merged, len(secondaries), obj.Id()))
+	}
+	return nil
+}
+
+// extract the details used for duplicate identification from the work directory
+func summarizeWork(dirname string) (workSummary, error) {
+
+	ws := workSummary{dirname: dirname}
+	buf, err := loadFile(fmt.Sprintf("%s/work.json", dirname))
+	if err != nil {
+		return ws, err
+	}
+
+	// the title is multi-valued in Hyrax exports but accepts the single valued Sufia title
+	work := HyraxWorkJson{}
+	if err = decodeJson(buf, &work); err != nil {
+		return ws, err
+	}
+
+	ws.id = work.Id.value
+	if len(work.PermanentUrl.value) != 0 {
+		ws.doi = strings.ToLower(cleanupDoi(work.PermanentUrl.value))
+	}
+
+	// common titles are only a match with the same author
+	title := normalizeForMatch(work.Title.first())
+	author := normalizeForMatch(fmt.Sprintf("%s %s", work.AuthorLastName.value, work.AuthorFirstName.value))
+	if len(title) != 0 && len(author) != 0 {
+		ws.titleAuthor = fmt.Sprintf("%s|%s", title, author)
+	}
+
+	hashes := make([]string, 0)
+	ix := 1
+	for fileExists(fmt.Sprintf("%s/fileset-%d.json", dirname, ix)) == true {
+		buf, err = loadFile(fmt.Sprintf("%s/fileset-%d.json", dirname, ix))
+		if err != nil {
+			return ws, err
+		}
+		fname, _, err := extractName(buf)
+		if err != nil {
+			return ws, fmt.Errorf("fileset-%d.json: %w", ix, err)
+		}
+		if len(fname) != 0 {
+			h, err := hashFile(fmt.Sprintf("%s/%s", dirname, fname))
+			if err == nil && slices.Contains(hashes, h) == false {
+				hashes = append(hashes, h)
+			}
+		}
+		ix++
+	}
+	slices.Sort(hashes)
+	ws.hashes = hashes
+
+	return ws, nil
+}
+
+var nonAlphaNumeric = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// compose, lowercase and remove punctuation and repeated whitespace so that trivial
+// differences do not matter, letters and digits in any script are kept
+func normalizeForMatch(str string) string {
+	clean := nonAlphaNumeric.ReplaceAllString(strings.ToLower(norm.NFC.String(str)), " ")
+	return strings.TrimSpace(clean)
+}
+
+// the hash of a file (streamed so we do not load the whole thing), unless the source
+// already knows it
+func hashFile(filename string) (string, error) {
+	if hs, ok := inputSource.(hashingSource); ok == true {
+		if h, found := hs.fileHash(filename); found == true {
+			return h, nil
+		}
+	}
+	f, err := inputSource.open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashBytes(buf []byte) string {
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+//
+// end of file
+//
@@ -0,0 +1,160 @@
+//
+// tests for the cross-work duplicate detection
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// a minimal work directory with the supplied files (name -> content)
+func makeDuplicateWork(t *testing.T, root string, name string, id string, title string, files ...string) string {
+	dirname := filepath.Join(root, name)
+	if err := os.MkdirAll(dirname, 0755); err != nil {
+		t.Fatalf("creating %s (%s)", dirname, err.Error())
+	}
+	work := fmt.Sprintf(`{"id": %q, "title": [%q], "author_first_name": "Pat", "author_last_name": "Jones"}`, id, title)
+	if err := os.WriteFile(filepath.Join(dirname, "work.json"), []byte(work), 0644); err != nil {
+		t.Fatalf("writing work (%s)", err.Error())
+	}
+	for ix, content := range files {
+		fname := fmt.Sprintf("%s-%d.txt", name, ix+1)
+		fileset := fmt.Sprintf(`{"title": [%q]}`, fname)
+		if err := os.WriteFile(filepath.Join(dirname, fmt.Sprintf("fileset-%d.json", ix+1)), []byte(fileset), 0644); err != nil {
+			t.Fatalf("writing fileset (%s)", err.Error())
+		}
+		if err := os.WriteFile(filepath.Join(dirname, fname), []byte(content), 0644); err != nil {
+			t.Fatalf("writing file (%s)", err.Error())
+		}
+	}
+	return dirname
+}
+
+func TestIndexDuplicates(t *testing.T) {
+
+	root := t.TempDir()
+	a := makeDuplicateWork(t, root, "a", "work-a", "First Title", "one", "two")
+	b := makeDuplicateWork(t, root, "b", "work-b", "Second Title", "one")
+	c := makeDuplicateWork(t, root, "c", "work-c", "Third Title", "two", "one", "two")
+	d := makeDuplicateWork(t, root, "d", "work-a", "Fourth Title")
+	e := makeDuplicateWork(t, root, "e", "work-e", "second title!", "three")
+	f := makeDuplicateWork(t, root, "f", "work-f", "Fifth Title", "two", "three")
+
+	index := indexDuplicates([]string{a, b, c, d, e, f})
+
+	tests := []struct {
+		dirname string
+		primary string // empty if not a duplicate
+	}{
+		{a, ""},
+		{b, ""}, // shares one file with a
+		{c, a},  // the same files as a
+		{d, a},  // the same id as a
+		{e, b},  // the same title and author as b
+		{f, ""}, // shares one file with c and one with e
+	}
+
+	for _, test := range tests {
+		dup, found := index.duplicates[test.dirname]
+		if found != (len(test.primary) != 0) || dup.primary != test.primary {
+			t.Errorf("%s: expected primary %q, got %+v", test.dirname, test.primary, dup)
+		}
+	}
+	if slices.Equal(index.secondaries[a], []string{c, d}) == false {
+		t.Errorf("expected secondaries %v, got %v", []string{c, d}, index.secondaries[a])
+	}
+	if index.samePrimary([]string{a, c, d}) == false || index.samePrimary([]string{a, b}) == true {
+		t.Errorf("unexpected primary grouping")
+	}
+}
+
+// a common title is only a match with the same author
+func TestDuplicateTitleAuthor(t *testing.T) {
+
+	root := t.TempDir()
+	dirs := make([]string, 0)
+	for ix, work := range []string{
+		`{"id": "w1", "title": ["Essays"]}`,
+		`{"id": "w2", "title": ["Essays"]}`,
+		`{"id": "w3", "title": ["Essays"], "author_last_name": "Jones"}`,
+		`{"id": "w4", "title": ["ESSAYS."], "author_last_name": "Jones"}`,
+	} {
+		dirname := filepath.Join(root, fmt.Sprintf("w%d", ix+1))
+		os.MkdirAll(dirname, 0755)
+		if err := os.WriteFile(filepath.Join(dirname, "work.json"), []byte(work), 0644); err != nil {
+			t.Fatalf("writing work (%s)", err.Error())
+		}
+		dirs = append(dirs, dirname)
+	}
+
+	index := indexDuplicates(dirs)
+	if len(index.works[0].titleAuthor) != 0 || index.isDuplicate(dirs[1]) == true {
+		t.Errorf("expected works without an author not to match, got %+v", index.works[:2])
+	}
+	if index.isDuplicate(dirs[2]) == true || index.primaryOf(dirs[3]) != dirs[2] {
+		t.Errorf("expected %s to duplicate %s", dirs[3], dirs[2])
+	}
+}
+
+func TestNormalizeForMatch(t *testing.T) {
+
+	tests := map[string]string{
+		"  The Title: A Study!  ": "the title a study",
+		"Über die Grenzen":        "über die grenzen",
+		"Über die Grenzen":       "über die grenzen",
+		"Война и мир":             "война и мир",
+		"紅樓夢":                     "紅樓夢",
+		"---":                     "",
+		"Chapter 3, 2nd edition":  "chapter 3 2nd edition",
+	}
+
+	for in, expected := range tests {
+		if got := normalizeForMatch(in); got != expected {
+			t.Errorf("normalizeForMatch(%q) = %q, expected %q", in, got, expected)
+		}
+	}
+}
+
+func TestPromoteDuplicate(t *testing.T) {
+
+	root := t.TempDir()
+	a := makeDuplicateWork(t, root, "a", "work-a", "First Title", "one")
+	b := makeDuplicateWork(t, root, "b", "work-a", "Second Title", "two")
+	c := makeDuplicateWork(t, root, "c", "work-a", "Third Title", "three")
+	index := indexDuplicates([]string{a, b, c})
+
+	if got := index.promote(b); len(got) != 0 {
+		t.Errorf("expected no promotion for a secondary, got %s", got)
+	}
+	if got := index.promote(a); got != b {
+		t.Fatalf("expected %s to be promoted, got %q", b, got)
+	}
+	if index.isDuplicate(b) == true || index.isDuplicate(c) == false {
+		t.Errorf("expected %s to be the primary and %s a duplicate", b, c)
+	}
+	if index.primaryOf(c) != b || slices.Equal(index.secondaries[b], []string{c}) == false || len(index.secondaries[a]) != 0 {
+		t.Errorf("expected %s to be the duplicate of %s, got %+v", c, b, index)
+	}
+
+	// and again when the new primary fails
+	if got := index.promote(b); got != c || index.isDuplicate(c) == true || len(index.duplicates) != 0 {
+		t.Errorf("expected %s to be promoted, got %q (%+v)", c, got, index)
+	}
+	if got := index.promote(c); len(got) != 0 {
+		t.Errorf("expected no promotion, got %s", got)
+	}
+
+	var none *duplicateIndex
+	if got := none.promote(a); len(got) != 0 {
+		t.Errorf("expected no promotion without an index, got %s", got)
+	}
+}
+
+//
+// end of file
+//
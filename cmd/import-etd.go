@@ -19,13 +19,40 @@ var etdRights = map[string]string{
 	"All rights reserved (no additional license for public reuse)": "",
 }
 
-func makeEtdObject(namespace string, indir string, excludeFiles bool) (uvaeasystore.EasyStoreObject, error) {
+func makeEtdObject(namespace string, indir string, opts importOptions, wr *workReport) (uvaeasystore.EasyStoreObject, error) {
 
 	// import domain metadata plus any extras that we need that dont have a place in the metadata
-	domainMetadata, domainExtras, err := libraEtdMetadata(indir)
+	domainMetadata, domainExtras, err := libraEtdMetadata(indir, wr)
 	if err != nil {
 		return nil, err
 	}
+	wr.Schema = domainExtras.schema
+	wr.Diagnostics = domainExtras.diagnostics
+
+	// some diagnostics may fail the work
+	if err = opts.diagnostics.check(domainExtras.diagnostics); err != nil {
+		return nil, err
+	}
+
+	// tidy up the text before it is stored
+	opts.cleanup.apply(&domainMetadata)
+
+	// map the language names and codes to the controlled values
+	var unmapped []string
+	domainMetadata.Language, unmapped = opts.languages.normalize(domainMetadata.Language, opts.language)
+	for _, lang := range unmapped {
+		wr.logWarning(fmt.Sprintf("unrecognized language (%s), keeping it", lang))
+	}
+
+	// map the legacy program and degree values, the author department is the program
+	program := domainMetadata.Program
+	opts.vocabulary.apply(&domainMetadata.Program, &domainMetadata.Degree, wr)
+	if domainMetadata.Author.Department == program {
+		domainMetadata.Author.Department = domainMetadata.Program
+	}
+
+	// tidy up the related URLs
+	domainMetadata.RelatedURLs = opts.related.apply(domainMetadata.RelatedURLs, wr)
 
 	// import base object
 	obj, err := standardObject(namespace, indir)
@@ -33,11 +60,14 @@ func makeEtdObject(namespace string, indir string, excludeFiles bool) (uvaeasyst
 		return nil, err
 	}
 
+	wr.Id = obj.Id()
+
 	// import fields from metadata
-	fields, err := libraEtdFields(domainMetadata, domainExtras)
+	fields, embargo, err := libraEtdFields(domainMetadata, domainExtras, opts, wr)
 	if err != nil {
 		return nil, err
 	}
+	wr.Embargo = embargo.explanation
 
 	// serialize domain metadata
 	buf, err := domainMetadata.Payload()
@@ -48,19 +78,19 @@ func makeEtdObject(namespace string, indir string, excludeFiles bool) (uvaeasyst
 	// create our store metadata object
 	metadata := uvaeasystore.NewEasyStoreMetadata(domainMetadata.MimeType(), buf)
 
-	// assign fields and serialized metadata
-	obj.SetFields(fields)
-	obj.SetMetadata(metadata)
-
 	// do we include files?
-	if excludeFiles == false {
+	if opts.excludeFiles == false {
 		// import files if they exist
-		blobs, err := importBlobs(namespace, indir)
+		blobs, filesets, err := importBlobs(namespace, indir, mostVisible(embargo.defaultVisibility, embargo.releaseVisibility), opts, wr)
 		if err != nil {
 			return nil, err
 		}
 
 		if len(blobs) != 0 {
+			fields["filesets"], err = makeFilesetsField(filesets)
+			if err != nil {
+				return nil, err
+			}
 			obj.SetFiles(blobs)
 			logDebug(fmt.Sprintf("imported %d files(s) for [%s]", len(blobs), obj.Id()))
 		} else {
@@ -68,10 +98,14 @@ func makeEtdObject(namespace string, indir string, excludeFiles bool) (uvaeasyst
 		}
 	}
 
+	// assign fields and serialized metadata
+	obj.SetFields(fields)
+	obj.SetMetadata(metadata)
+
 	return obj, nil
 }
 
-func libraEtdMetadata(indir string) (librametadata.ETDWork, importExtras, error) {
+func libraEtdMetadata(indir string, wr *workReport) (librametadata.ETDWork, importExtras, error) {
 	meta := librametadata.ETDWork{}
 	extra := importExtras{}
 
@@ -86,135 +120,92 @@ func libraEtdMetadata(indir string) (librametadata.ETDWork, importExtras, error)
 		return meta, extra, err
 	}
 
-	meta.Program, err = extractString("department", omap["department"])
-	if err != nil {
-		logDebug(err.Error())
-	}
-
-	meta.Degree, err = extractString("degree", omap["degree"])
-	if err != nil {
-		logDebug(err.Error())
-	}
-
-	meta.Title, err = extractFirstString("title", omap["title"])
-	if err != nil {
-		logDebug(err.Error())
-	}
-
-	// meta.Author handled below
-
-	// meta.Advisors handled below
-
-	meta.Abstract, err = extractString("description", omap["description"])
-	if err != nil {
-		logDebug(err.Error())
-	}
-
-	rights, err := extractFirstString("rights", omap["rights"])
-	if err != nil {
-		logDebug(err.Error())
-	}
-
-	meta.License, meta.LicenseURL = libraEtdRights(rights)
-
-	meta.Keywords, err = extractStringArray("keyword", omap["keyword"])
-	if err != nil {
-		logDebug(err.Error())
-	}
-
-	meta.Language, err = extractString("language", omap["language"])
-	if err != nil {
-		logDebug(err.Error())
-	}
-
-	meta.RelatedURLs, err = extractStringArray("related_url", omap["related_url"])
-	if err != nil {
-		logDebug(err.Error())
-	}
-
-	extra.pubDate, err = extractString("date_published", omap["date_published"])
-	if err != nil {
-		logDebug(err.Error())
-	}
-
-	meta.Sponsors, err = extractStringArray("sponsoring_agency", omap["sponsoring_agency"])
+	// the mapping depends on the export schema
+	schema, err := detectSchema(omap)
 	if err != nil {
-		logDebug(err.Error())
-	}
-
-	meta.Notes, err = extractString("notes", omap["notes"])
-	if err != nil {
-		logDebug(err.Error())
-	}
-
-	extra.depositor, err = extractString("depositor", omap["depositor"])
-	if err != nil {
-		logDebug(err.Error())
+		return meta, extra, err
 	}
 
-	meta.Author, err = libraEtdAuthor(omap)
-	if err != nil {
-		logDebug(err.Error())
+	var diagnostics []workDiagnostic
+	switch schema {
+	case schemaSufiaEtd:
+		work := SufiaWorkJson{}
+		if err = decodeJson(buf, &work); err != nil {
+			return meta, extra, err
+		}
+		meta, extra = sufiaEtdMetadata(work, wr)
+		diagnostics = diagnoseWork(work)
+	default:
+		work := HyraxWorkJson{}
+		if err = decodeJson(buf, &work); err != nil {
+			return meta, extra, err
+		}
+		meta, extra = hyraxEtdMetadata(work, wr)
+		diagnostics = diagnoseWork(work)
 	}
+	extra.schema = schema
+	extra.directory = indir
+	extra.workHash = hashBytes(buf)
+	extra.diagnostics = diagnostics
+	logDiagnostics(diagnostics)
 
-	meta.Advisors, err = libraEtdAdvisors(omap)
-	if err != nil {
-		logDebug(err.Error())
-	}
+	//logEtdMetadata(meta)
+	return meta, extra, nil
+}
 
-	extra.defaultVis, err = extractString("embargo_state", omap["embargo_state"])
-	if err != nil {
-		logDebug(err.Error())
-	}
+// the metadata common to all the export schemas
+func commonEtdMetadata(work EtdWorkJson) (librametadata.ETDWork, importExtras) {
+	meta := librametadata.ETDWork{}
+	extra := importExtras{}
 
-	extra.createDate, err = extractString("date_created", omap["date_created"])
-	if err != nil {
-		logDebug(err.Error())
-	}
+	meta.Program = work.Department.value
+	meta.Degree = work.Degree.value
+	meta.Abstract = work.Description.value
+	meta.Keywords = work.Keyword.list()
+	meta.Language = work.Language.value
+	meta.RelatedURLs = work.RelatedUrl.list()
+	meta.Sponsors = work.SponsoringAgency.list()
+	meta.Notes = work.Notes.value
+	meta.Author = libraEtdAuthor(work)
 
 	//
 	// extra stuff that does not form part of the metadata but is stored in the object fields
 	//
 
-	extra.adminNotes, err = extractStringArray("admin_notes", omap["admin_notes"])
-	if err != nil {
-		logDebug(err.Error())
-	}
-
-	extra.doi, err = extractString("permanent_url", omap["permanent_url"])
-	if err != nil {
-		logDebug(err.Error())
-	}
-
-	extra.depositor, err = extractString("depositor", omap["depositor"])
-	if err != nil {
-		logDebug(err.Error())
-	}
-
-	extra.embargoRelease, err = extractString("embargo_end_date", omap["embargo_end_date"])
-	if err != nil {
-		logDebug(err.Error())
-	}
-
-	extra.embargoVisDuring = extra.defaultVis
-	extra.embargoVisAfter = "open"
-
-	extra.createDate, err = extractString("date_created", omap["date_created"])
-	if err != nil {
-		logDebug(err.Error())
-	}
+	extra.pubDate = work.DatePublished.value
+	extra.depositor = work.Depositor.value
+	extra.defaultVis = work.EmbargoState.value
+	extra.createDate = work.DateCreated.value
+	extra.adminNotes = work.AdminNotes.list()
+	extra.doi = work.PermanentUrl.value
+	extra.embargo = libraEtdEmbargo(work)
+	extra.source = work.WorkSource.value
+	extra.workId = work.Id.value
+
+	return meta, extra
+}
 
-	extra.source, err = extractString("work_source", omap["work_source"])
-	if err != nil {
-		logDebug(err.Error())
-	}
+// the Hyrax export mapping
+func hyraxEtdMetadata(work HyraxWorkJson, wr *workReport) (librametadata.ETDWork, importExtras) {
+	meta, extra := commonEtdMetadata(work.EtdWorkJson)
+	meta.Title = work.Title.first()
+	meta.License, meta.LicenseURL = libraEtdRights(work.Rights.first())
+	meta.Advisors = hyraxEtdAdvisors(work.Contributor.values, wr)
+	return meta, extra
+}
 
-	//logEtdMetadata(meta)
-	return meta, extra, nil
+// the Sufia export mapping, the same as Hyrax other than the single valued fields and
+// the contributor encoding
+func sufiaEtdMetadata(work SufiaWorkJson, wr *workReport) (librametadata.ETDWork, importExtras) {
+	meta, extra := commonEtdMetadata(work.EtdWorkJson)
+	meta.Title = work.Title.value
+	meta.License, meta.LicenseURL = libraEtdRights(work.Rights.value)
+	meta.Advisors = sufiaEtdAdvisors(work.Contributor.list, wr)
+	return meta, extra
 }
 
 // extract fields from the domain metadata plus the extras
-func libraEtdFields(meta librametadata.ETDWork, extra importExtras) (uvaeasystore.EasyStoreObjectFields, error) {
+func libraEtdFields(meta librametadata.ETDWork, extra importExtras, opts importOptions, wr *workReport) (uvaeasystore.EasyStoreObjectFields, embargoDecision, error) {
 	fields := uvaeasystore.DefaultEasyStoreFields()
 
 	// all imported items get these
@@ -226,9 +217,15 @@ func libraEtdFields(meta librametadata.ETDWork, extra importExtras) (uvaeasystor
 	// all imported ETD's get these
 	fields["sis-sent"] = "imported"
 
-	if len(extra.adminNotes) != 0 {
-		fields["admin-notes"] = strings.Join(extra.adminNotes, " ")
+	// the export notes plus a note recording the import
+	notes, err := makeAdminNotes(extra.adminNotes, opts.run, extra.directory)
+	if err != nil {
+		return nil, embargoDecision{}, err
 	}
+	fields["admin-notes"] = notes
+
+	// where the object came from
+	addProvenance(fields, opts.run, extra.directory, extra.workId, extra.workHash)
 
 	if len(meta.Author.ComputeID) != 0 {
 		fields["author"] = meta.Author.ComputeID
@@ -242,47 +239,26 @@ func libraEtdFields(meta librametadata.ETDWork, extra importExtras) (uvaeasystor
 		fields["depositor"] = strings.Replace(extra.depositor, "@virginia.edu", "", -1)
 	}
 
-	// we may adjust this later if we have embargo information
-	if len(extra.defaultVis) != 0 {
-		fields["default-visibility"] = extra.defaultVis
-	}
-
 	if len(extra.doi) != 0 {
-		// cleanup the DOI
-		doi := strings.Replace(extra.doi, "https://doi.org/", "", 1)
-		doi = strings.Replace(doi, "http://dx.doi.org/", "", 1)
-		fields["doi"] = fmt.Sprintf("https://doi.org/%s", doi)
+		fields["doi"] = fmt.Sprintf("https://doi.org/%s", cleanupDoi(extra.doi))
 	}
 
-	// embargo visibility calculations
-	if len(extra.embargoRelease) != 0 {
-		extra.embargoRelease = cleanupDate(extra.embargoRelease)
-		fields["embargo-release"] = extra.embargoRelease
-		if inTheFuture(extra.embargoRelease) == true {
-			if len(extra.embargoVisDuring) != 0 {
-				fields["default-visibility"] = extra.embargoVisDuring
-			}
-		}
-
-		if len(extra.embargoVisAfter) != 0 {
-			fields["embargo-release-visibility"] = extra.embargoVisAfter
-		} else {
-			fields["embargo-release-visibility"] = extra.defaultVis
-		}
-	}
-
-	// field name change
-	if fields["default-visibility"] == "authenticated" {
-		fields["default-visibility"] = "uva"
+	// visibility and embargo calculations
+	embargo := opts.embargo.apply(extra.defaultVis, extra.embargo, opts.asOf)
+	if len(embargo.defaultVisibility) != 0 {
+		fields["default-visibility"] = embargo.defaultVisibility
 	}
-	if fields["embargo-release-visibility"] == "authenticated" {
-		fields["embargo-release-visibility"] = "uva"
+	if len(embargo.releaseDate) != 0 {
+		fields["embargo-release"] = embargo.releaseDate
+		fields["embargo-release-visibility"] = embargo.releaseVisibility
 	}
 
 	if len(extra.pubDate) != 0 {
-		date := cleanupDate(extra.pubDate)
+		date := interpretDate(extra.pubDate)
 		if len(date) != 0 {
 			fields["publish-date"] = date
+		} else {
+			wr.logError(fmt.Sprintf("unable to interpret date [%s], setting empty", extra.pubDate))
 		}
 	}
 
@@ -292,51 +268,58 @@ func libraEtdFields(meta librametadata.ETDWork, extra importExtras) (uvaeasystor
 			strings.Split(extra.source, ":")[0], " ")
 	}
 
-	return fields, nil
+	return fields, embargo, nil
 }
 
-func libraEtdAuthor(omap map[string]interface{}) (librametadata.ContributorData, error) {
-
-	author := librametadata.ContributorData{}
-	var err error
+// remove the resolver prefix from the DOI
+func cleanupDoi(doi string) string {
+	clean := strings.Replace(doi, "https://doi.org/", "", 1)
+	clean = strings.Replace(clean, "http://dx.doi.org/", "", 1)
+	return clean
+}
 
-	author.ComputeID, err = extractString("author_email", omap["author_email"])
-	if err != nil {
-		logDebug(err.Error())
+func libraEtdAuthor(work EtdWorkJson) librametadata.ContributorData {
+	return librametadata.ContributorData{
+		ComputeID:   strings.Replace(work.AuthorEmail.value, "@virginia.edu", "", -1),
+		FirstName:   work.AuthorFirstName.value,
+		LastName:    work.AuthorLastName.value,
+		Department:  work.Department.value,
+		Institution: work.AuthorInstitution.value,
 	}
-	author.ComputeID = strings.Replace(author.ComputeID, "@virginia.edu", "", -1)
+}
 
-	author.FirstName, err = extractString("author_first_name", omap["author_first_name"])
-	if err != nil {
-		logDebug(err.Error())
-	}
+// embargo details may appear as a separate embargo object or as top level fields
+func libraEtdEmbargo(work EtdWorkJson) EmbargoDetails {
 
-	author.LastName, err = extractString("author_last_name", omap["author_last_name"])
-	if err != nil {
-		logDebug(err.Error())
+	during := work.VisibilityDuringEmbargo
+	after := work.VisibilityAfterEmbargo
+	release := work.EmbargoReleaseDate
+	if work.Embargo.present == true {
+		during = work.Embargo.VisibilityDuring
+		after = work.Embargo.VisibilityAfter
+		release = work.Embargo.ReleaseDate
 	}
 
-	author.Department, err = extractString("department", omap["department"])
-	if err != nil {
-		logDebug(err.Error())
+	embargo := EmbargoDetails{
+		VisibilityDuring: during.value,
+		VisibilityAfter:  after.value,
+		ReleaseDate:      release.value,
 	}
-
-	author.Institution, err = extractString("author_institution", omap["author_institution"])
-	if err != nil {
-		logDebug(err.Error())
+	if during.present == false {
+		embargo.VisibilityDuring = work.EmbargoState.value
 	}
-
-	return author, nil
+	if after.present == false {
+		embargo.VisibilityAfter = "open"
+	}
+	if release.present == false {
+		embargo.ReleaseDate = work.EmbargoEndDate.value
+	}
+	return embargo
 }
 
-func libraEtdAdvisors(omap map[string]interface{}) ([]librametadata.ContributorData, error) {
-
-	advisors := make([]librametadata.ContributorData, 0)
-	contributors, err := extractStringArray("contributor", omap["contributor"])
-	if err != nil {
-		logDebug(err.Error())
-		return advisors, nil
-	}
+// Hyrax contributors are newline encoded (index, computing id, first name, last name,
+// department, institution)
+func hyraxEtdAdvisors(contributors []string, wr *workReport) []librametadata.ContributorData {
 
 	local := make([]LocalContributorData, 0)
 	for _, str := range contributors {
@@ -346,9 +329,10 @@ func libraEtdAdvisors(omap map[string]interface{}) ([]librametadata.ContributorD
 		sarray := strings.Split(str, "\n")
 		if len(sarray) == 6 {
 			var advisor LocalContributorData
+			var err error
 			advisor.Index, err = strconv.Atoi(sarray[0])
 			if err != nil {
-				logWarning(err.Error())
+				wr.logWarning(err.Error())
 				continue
 			}
 			advisor.ComputeID = sarray[1]
@@ -360,11 +344,37 @@ func libraEtdAdvisors(omap map[string]interface{}) ([]librametadata.ContributorD
 			// and add to the list
 			local = append(local, advisor)
 		} else {
-			logWarning("badly formatted contributor entry")
+			wr.logWarning("badly formatted contributor entry")
+		}
+	}
+	return sortedAdvisors(local)
+}
+
+// Sufia contributors are objects rather than newline encoded strings
+func sufiaEtdAdvisors(contributors []SufiaContributorJson, wr *workReport) []librametadata.ContributorData {
+
+	local := make([]LocalContributorData, 0)
+	for _, c := range contributors {
+		if c.Index.present == false {
+			wr.logWarning("contributor entry has no index")
+			continue
 		}
+		local = append(local, LocalContributorData{
+			Index:       c.Index.value,
+			ComputeID:   c.ComputingId.value,
+			FirstName:   c.FirstName.value,
+			LastName:    c.LastName.value,
+			Department:  c.Department.value,
+			Institution: c.Institution.value,
+		})
 	}
+	return sortedAdvisors(local)
+}
 
-	// we need to ensure that these are included in the order they were added
+// we need to ensure that these are included in the order they were added
+func sortedAdvisors(local []LocalContributorData) []librametadata.ContributorData {
+
+	advisors := make([]librametadata.ContributorData, 0)
 	sort.Sort(ContributorSorter(local))
 	for _, p := range local {
 		advisors = append(advisors, librametadata.ContributorData{
@@ -375,7 +385,7 @@ func libraEtdAdvisors(omap map[string]interface{}) ([]librametadata.ContributorD
 			Institution: p.Institution,
 		})
 	}
-	return advisors, nil
+	return advisors
 }
 
 func libraEtdRights(rights string) (string, string) {
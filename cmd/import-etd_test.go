@@ -0,0 +1,225 @@
+//
+// golden file tests for the ETD object construction
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/uvalib/easystore/uvaeasystore"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// go test ./cmd -run Golden -update
+var updateGoldens = flag.Bool("update", false, "update the golden files")
+
+var fixtureDir = "testdata/fixtures"
+var goldenDir = "testdata/golden"
+var goldenNamespace = "libraetd"
+
+// a fixed reference time so embargo decisions do not change as time passes
+var goldenAsOf = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// what we compare, a stable representation of the object and what happened to it
+type goldenWork struct {
+	Namespace   string            `json:"namespace,omitempty"`
+	Id          string            `json:"id,omitempty"`
+	Schema      string            `json:"schema,omitempty"`
+	Fields      map[string]string `json:"fields,omitempty"`
+	Metadata    json.RawMessage   `json:"metadata,omitempty"`
+	Files       []goldenFile      `json:"files,omitempty"`
+	Embargo     []string          `json:"embargo,omitempty"`
+	Warnings    []string          `json:"warnings,omitempty"`
+	Diagnostics []string          `json:"diagnostics,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+type goldenFile struct {
+	Name     string `json:"name"`
+	MimeType string `json:"mime_type"`
+	Size     int    `json:"size"`
+	Hash     string `json:"sha256"`
+}
+
+func goldenOptions() importOptions {
+	related, _ := newRelatedUrlPolicy("flag", "")
+	return importOptions{embargo: defaultEmbargoPolicy(), cleanup: defaultTextCleanup(), language: "label",
+		languages: defaultLanguageTable(), vocabulary: defaultVocabulary(), related: related, privateFiles: "skip", asOf: goldenAsOf,
+		run: importRun{id: "golden-run", version: "golden-version", root: fixtureDir, export: "golden-export",
+			started: goldenAsOf}}
+}
+
+func TestEtdObjectGolden(t *testing.T) {
+	checkGoldenWorks(t, fixtureDir, *updateGoldens)
+}
+
+// build the object for each work in the export and compare it with its golden file. The
+// goldens are only updated from the fixture directory, other sources are compared with them
+func checkGoldenWorks(t *testing.T, root string, update bool) {
+
+	items, err := inputSource.readDir(root)
+	if err != nil {
+		t.Fatalf("reading %s (%s)", root, err.Error())
+	}
+
+	dirs := make([]string, 0, len(items))
+	for _, i := range items {
+		if i.isDir == true {
+			dirs = append(dirs, fmt.Sprintf("%s/%s", root, i.name))
+		}
+	}
+	if len(dirs) == 0 {
+		t.Fatalf("no works found in %s", root)
+	}
+
+	// legacy links are resolved against the works in the export, as for a real run
+	opts := goldenOptions()
+	opts.run.root = root
+	opts.related.indexWorks(dirs)
+
+	es := newMemoryEasyStore()
+	for _, dirname := range dirs {
+		t.Run(path.Base(dirname), func(t *testing.T) {
+			wr := &workReport{Directory: dirname}
+			obj, err := makeEtdObject(goldenNamespace, dirname, opts, wr)
+			if err == nil {
+				_, err = es.ObjectCreate(obj)
+				if err != nil {
+					t.Fatalf("creating object (%s)", err.Error())
+				}
+				obj, err = es.ObjectGetByKey(goldenNamespace, obj.Id(), uvaeasystore.AllComponents)
+				if err != nil {
+					t.Fatalf("getting object (%s)", err.Error())
+				}
+			}
+			filename := filepath.Join(goldenDir, fmt.Sprintf("%s.json", path.Base(dirname)))
+			got := makeGolden(t, obj, wr, err)
+			if update == true {
+				updateGolden(t, filename, got)
+				return
+			}
+			compareGolden(t, filename, got)
+		})
+	}
+}
+
+func TestEtdObjectCreateConflict(t *testing.T) {
+
+	es := newMemoryEasyStore()
+	dirname := filepath.Join(fixtureDir, "basic")
+	for ix := 0; ix < 2; ix++ {
+		obj, err := makeEtdObject(goldenNamespace, dirname, goldenOptions(), &workReport{})
+		if err != nil {
+			t.Fatalf("creating object (%s)", err.Error())
+		}
+		_, err = es.ObjectCreate(obj)
+		if ix == 0 && err != nil {
+			t.Fatalf("unexpected error (%s)", err.Error())
+		}
+		if ix == 1 && errors.Is(err, uvaeasystore.ErrAlreadyExists) == false {
+			t.Fatalf("expected already exists, got (%v)", err)
+		}
+	}
+}
+
+func TestCleanupDate(t *testing.T) {
+
+	tests := map[string]string{
+		"2019":                     "2019-01-01T00:00:00Z",
+		"2019-05-01":               "2019-05-01T00:00:00Z",
+		"May 1, 2019":              "2019-05-01T00:00:00Z",
+		"May 1st 2019":             "2019-01-01T00:00:00Z", // falls back to the year
+		"June 5th, 2015":           "2015-06-05T00:00:00Z",
+		"Sept. 2012":               "2012-01-01T00:00:00Z", // falls back to the year
+		"January 2012":             "2012-01-01T00:00:00Z",
+		"05/01/2019":               "2019-05-01T00:00:00Z",
+		"2019/05/01":               "2019-05-01T00:00:00Z",
+		"1 May 2019":               "2019-05-01T00:00:00Z",
+		"2019-05":                  "2019-05-01T00:00:00Z",
+		"5/1/2019":                 "2019-05-01T00:00:00Z",
+		"5/1/19":                   "2019-05-01T00:00:00Z",
+		"5-1-2019":                 "2019-05-01T00:00:00Z",
+		"2011-04-04T10:11:12.000Z": "2011-04-04T10:11:12Z",
+		"Spring semester 2011":     "2011-01-01T00:00:00Z",
+		"not a date":               "",
+		"":                         "",
+	}
+
+	for in, expected := range tests {
+		got := cleanupDate(in)
+		if got != expected {
+			t.Errorf("cleanupDate(%q) = %q, expected %q", in, got, expected)
+		}
+	}
+}
+
+// build the golden representation
+func makeGolden(t *testing.T, obj uvaeasystore.EasyStoreObject, wr *workReport, err error) []byte {
+
+	gw := goldenWork{Schema: wr.Schema, Embargo: wr.Embargo}
+
+	// warnings may name the work directory, which depends on the import source
+	for _, w := range wr.Warnings {
+		gw.Warnings = append(gw.Warnings, strings.ReplaceAll(w, wr.Directory+"/", ""))
+	}
+	for _, d := range wr.Diagnostics {
+		gw.Diagnostics = append(gw.Diagnostics, d.String())
+	}
+	if err != nil {
+		gw.Error = err.Error()
+	} else {
+		gw.Namespace = obj.Namespace()
+		gw.Id = obj.Id()
+		gw.Fields = obj.Fields()
+		if obj.Metadata() != nil {
+			gw.Metadata, err = obj.Metadata().Payload()
+			if err != nil {
+				t.Fatalf("serializing metadata (%s)", err.Error())
+			}
+		}
+		for _, b := range obj.Files() {
+			pl, _ := b.Payload()
+			gw.Files = append(gw.Files, goldenFile{Name: b.Name(), MimeType: b.MimeType(), Size: len(pl), Hash: hashBytes(pl)})
+		}
+	}
+
+	buf, err := json.MarshalIndent(gw, "", "  ")
+	if err != nil {
+		t.Fatalf("serializing golden (%s)", err.Error())
+	}
+	return append(buf, '\n')
+}
+
+// write the golden file
+func updateGolden(t *testing.T, filename string, got []byte) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatalf("creating golden dir (%s)", err.Error())
+	}
+	if err := os.WriteFile(filename, got, 0644); err != nil {
+		t.Fatalf("writing golden (%s)", err.Error())
+	}
+}
+
+// compare against the golden file
+func compareGolden(t *testing.T, filename string, got []byte) {
+	expected, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("reading golden (%s), run with -update to create", err.Error())
+	}
+	if bytes.Equal(expected, got) == false {
+		t.Errorf("%s does not match, run with -update to accept\n--- expected\n%s\n--- got\n%s", filename, expected, got)
+	}
+}
+
+//
+// end of file
+//
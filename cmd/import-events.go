@@ -0,0 +1,181 @@
+//
+// domain events published by the importer so downstream services learn about imported works
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/uvalib/easystore/uvaeasystore"
+	"github.com/uvalib/librabus-sdk/uvalibrabus"
+	"os"
+	"strings"
+	"time"
+)
+
+// the event publishing options
+var publishPolicies = []string{"none", "bus", "file"}
+
+// the store event options, the store can publish its own events for each object (on),
+// not at all (off) or we can publish a single event for all the objects at the end (batch)
+var storeEventPolicies = []string{"on", "off", "batch"}
+
+// our event names
+var eventWorkImported = "import.work.imported" // a work was imported
+var eventRunComplete = "import.run.complete"   // an import run completed
+var eventBatchCreate = "import.batch.create"   // a batch of objects were created
+
+// the most ids we include in the batch event, the bus limits the event size so large
+// batches should use a manifest
+var maxBatchEventIds = 1000
+
+// detail for the work imported event
+type workImportedEvent struct {
+	VTag   string `json:"vtag"`   // object vtag
+	Source string `json:"source"` // the source work directory
+}
+
+// detail for the run complete event
+type runCompleteEvent struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Source   string    `json:"source"` // the import directory (or archive)
+	Shard    string    `json:"shard,omitempty"`
+	OkCount  int       `json:"ok_count"`
+	Skipped  int       `json:"skip_count"`
+	Errors   int       `json:"error_count"`
+}
+
+// detail for the batch create event
+type batchCreateEvent struct {
+	Count     int      `json:"count"`              // the number of objects created
+	Ids       []string `json:"ids"`                // the object ids (possibly truncated)
+	Truncated bool     `json:"truncated"`          // are there more ids than we included
+	Manifest  string   `json:"manifest,omitempty"` // the manifest file (if any)
+}
+
+type eventPublisher struct {
+	bus       uvalibrabus.UvaBus // where events go
+	sink      *fileBus           // file sink to close (if any)
+	namespace string             // the namespace we are importing into
+	failures  int                // events we were unable to publish
+}
+
+// create the event publisher. The bus uses BUSNAME and SOURCENAME from the environment,
+// the file sink appends events to the specified file. Returns nil when not publishing
+func newEventPublisher(policy string, eventFile string, namespace string) (*eventPublisher, error) {
+
+	publisher := &eventPublisher{namespace: namespace}
+	switch policy {
+	case "none":
+		return nil, nil
+
+	case "bus":
+		bus, err := uvalibrabus.NewUvaBus(uvalibrabus.UvaBusConfig{
+			Source:  os.Getenv("SOURCENAME"),
+			BusName: os.Getenv("BUSNAME"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		publisher.bus = bus
+
+	case "file":
+		if len(eventFile) == 0 {
+			return nil, fmt.Errorf("must specify an event file")
+		}
+		bus, err := newFileBus(eventFile)
+		if err != nil {
+			return nil, err
+		}
+		publisher.bus = bus
+		publisher.sink = bus
+
+	default:
+		return nil, fmt.Errorf("unsupported publish option (%s)", policy)
+	}
+	return publisher, nil
+}
+
+// publish the work imported event, failures are logged but do not fail the import
+func (p *eventPublisher) workImported(obj uvaeasystore.EasyStoreObject, dirname string) {
+	if p == nil {
+		return
+	}
+	detail := workImportedEvent{VTag: obj.VTag(), Source: dirname}
+	p.publish(eventWorkImported, obj.Id(), detail)
+}
+
+// publish the run complete event
+func (p *eventPublisher) runComplete(report *runReport, source string) {
+	if p == nil {
+		return
+	}
+	detail := runCompleteEvent{
+		Started:  report.Started,
+		Finished: report.Finished,
+		Source:   source,
+		Shard:    report.Shard,
+		OkCount:  report.OkCount,
+		Skipped:  report.Skipped,
+		Errors:   report.Errors,
+	}
+	p.publish(eventRunComplete, "", detail)
+}
+
+// publish the batch create event for the objects created during the run
+func (p *eventPublisher) batchCreate(ids []string, manifest string) {
+	if p == nil {
+		return
+	}
+	detail := batchCreateEvent{Count: len(ids), Ids: ids, Manifest: manifest}
+	if len(ids) > maxBatchEventIds {
+		detail.Ids = ids[:maxBatchEventIds]
+		detail.Truncated = true
+	}
+	p.publish(eventBatchCreate, "", detail)
+}
+
+// write the ids of the objects created during the run, one per line
+func writeManifest(filename string, ids []string) error {
+	buf := strings.Join(ids, "\n")
+	if len(ids) != 0 {
+		buf += "\n"
+	}
+	return os.WriteFile(filename, []byte(buf), 0644)
+}
+
+func (p *eventPublisher) publish(name string, id string, detail any) {
+
+	buf, err := json.Marshal(detail)
+	if err == nil {
+		event := uvalibrabus.UvaBusEvent{
+			EventName:  name,
+			Namespace:  p.namespace,
+			Identifier: id,
+			EventTime:  time.Now().UTC().Format(time.RFC3339),
+			Detail:     buf,
+		}
+		err = p.bus.PublishEvent(&event)
+	}
+
+	if err != nil {
+		logError(fmt.Sprintf("publishing %s event for [%s/%s] (%s), continuing", name, p.namespace, id, err.Error()))
+		p.failures++
+		return
+	}
+	logDebug(fmt.Sprintf("published %s event for [%s/%s]", name, p.namespace, id))
+}
+
+// release any resources
+func (p *eventPublisher) close() error {
+	if p == nil || p.sink == nil {
+		return nil
+	}
+	return p.sink.close()
+}
+
+//
+// end of file
+//
@@ -0,0 +1,144 @@
+//
+// tests for the import events and the file sink bus
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/uvalib/librabus-sdk/uvalibrabus"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEventPublisherFileSink(t *testing.T) {
+
+	eventFile := filepath.Join(t.TempDir(), "events.jsonl")
+	events, err := newEventPublisher("file", eventFile, goldenNamespace)
+	if err != nil {
+		t.Fatalf("creating publisher (%s)", err.Error())
+	}
+
+	es := newMemoryEasyStore()
+	dirname := filepath.Join(fixtureDir, "basic")
+	obj, err := makeEtdObject(goldenNamespace, dirname, goldenOptions(), &workReport{})
+	if err != nil {
+		t.Fatalf("creating object (%s)", err.Error())
+	}
+	created, err := es.ObjectCreate(obj)
+	if err != nil {
+		t.Fatalf("importing object (%s)", err.Error())
+	}
+
+	report := newRunReport(false, goldenAsOf)
+	report.finish(1, 0, 0)
+	events.workImported(created, dirname)
+	events.runComplete(report, fixtureDir)
+	if err = events.close(); err != nil {
+		t.Fatalf("closing publisher (%s)", err.Error())
+	}
+	if events.failures != 0 {
+		t.Fatalf("expected no publish failures, got %d", events.failures)
+	}
+
+	buf, err := os.ReadFile(eventFile)
+	if err != nil {
+		t.Fatalf("reading events (%s)", err.Error())
+	}
+	lines := bytes.Split(bytes.TrimSpace(buf), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(lines))
+	}
+
+	ev, err := uvalibrabus.MakeBusEvent(lines[0])
+	if err != nil {
+		t.Fatalf("decoding event (%s)", err.Error())
+	}
+	if ev.EventName != eventWorkImported || ev.Namespace != goldenNamespace || ev.Identifier != created.Id() {
+		t.Errorf("unexpected work event %s", ev.String())
+	}
+	if bytes.Contains(ev.Detail, []byte(created.VTag())) == false {
+		t.Errorf("expected the vtag in the event detail, got %s", string(ev.Detail))
+	}
+
+	ev, err = uvalibrabus.MakeBusEvent(lines[1])
+	if err != nil {
+		t.Fatalf("decoding event (%s)", err.Error())
+	}
+	if ev.EventName != eventRunComplete || bytes.Contains(ev.Detail, []byte(`"ok_count":1`)) == false {
+		t.Errorf("unexpected run event %s (%s)", ev.String(), string(ev.Detail))
+	}
+}
+
+func TestBatchCreateEvent(t *testing.T) {
+
+	dir := t.TempDir()
+	events, err := newEventPublisher("file", filepath.Join(dir, "events.jsonl"), goldenNamespace)
+	if err != nil {
+		t.Fatalf("creating publisher (%s)", err.Error())
+	}
+
+	ids := make([]string, 0)
+	for ix := 0; ix <= maxBatchEventIds; ix++ {
+		ids = append(ids, fmt.Sprintf("etd-%05d", ix))
+	}
+	manifest := filepath.Join(dir, "manifest.txt")
+	if err = writeManifest(manifest, ids); err != nil {
+		t.Fatalf("writing manifest (%s)", err.Error())
+	}
+	events.batchCreate(ids, manifest)
+	events.close()
+
+	buf, err := os.ReadFile(manifest)
+	if err != nil {
+		t.Fatalf("reading manifest (%s)", err.Error())
+	}
+	if bytes.Count(buf, []byte("\n")) != len(ids) {
+		t.Errorf("expected %d manifest lines", len(ids))
+	}
+
+	buf, err = os.ReadFile(filepath.Join(dir, "events.jsonl"))
+	if err != nil {
+		t.Fatalf("reading events (%s)", err.Error())
+	}
+	ev, err := uvalibrabus.MakeBusEvent(bytes.TrimSpace(buf))
+	if err != nil {
+		t.Fatalf("decoding event (%s)", err.Error())
+	}
+	var detail batchCreateEvent
+	if err = json.Unmarshal(ev.Detail, &detail); err != nil {
+		t.Fatalf("decoding detail (%s)", err.Error())
+	}
+	if ev.EventName != eventBatchCreate || detail.Count != len(ids) || detail.Truncated == false ||
+		len(detail.Ids) != maxBatchEventIds || detail.Manifest != manifest {
+		t.Errorf("unexpected batch event %s (%s)", ev.String(), string(ev.Detail))
+	}
+}
+
+func TestFileBusRejectsBlankEvent(t *testing.T) {
+	bus, err := newFileBus(filepath.Join(t.TempDir(), "events.jsonl"))
+	if err != nil {
+		t.Fatalf("creating bus (%s)", err.Error())
+	}
+	defer bus.close()
+
+	err = bus.PublishEvent(&uvalibrabus.UvaBusEvent{})
+	if errors.Is(err, uvalibrabus.ErrBadParameter) == false {
+		t.Errorf("expected a bad parameter error, got %v", err)
+	}
+
+	if _, err = newEventPublisher("file", "", goldenNamespace); err == nil {
+		t.Errorf("expected an error without an event file")
+	}
+	if events, err := newEventPublisher("none", "", goldenNamespace); events != nil || err != nil {
+		t.Errorf("expected no publisher")
+	}
+}
+
+//
+// end of file
+//
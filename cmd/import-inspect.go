@@ -0,0 +1,136 @@
+//
+// inspect mode, shows the object built from a single export directory without
+// touching any backend
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/uvalib/easystore/uvaeasystore"
+	"io"
+	"sort"
+)
+
+// what we built from the export directory
+type inspection struct {
+	Directory   string                             `json:"directory"`             // source directory
+	Namespace   string                             `json:"namespace,omitempty"`   // object namespace
+	Id          string                             `json:"id,omitempty"`          // work identifier
+	Work        json.RawMessage                    `json:"work,omitempty"`        // the serialized librametadata.ETDWork
+	Fields      uvaeasystore.EasyStoreObjectFields `json:"fields,omitempty"`      // the computed fields
+	Files       []inspectFile                      `json:"files,omitempty"`       // the blobs
+	Embargo     []string                           `json:"embargo,omitempty"`     // how the visibility was determined
+	Warnings    []string                           `json:"warnings,omitempty"`    // warnings raised
+	Diagnostics []workDiagnostic                   `json:"diagnostics,omitempty"` // problems found with the work metadata
+	Error       string                             `json:"error,omitempty"`       // why we could not build the object
+}
+
+type inspectFile struct {
+	Name     string `json:"name"`
+	Size     int    `json:"size"`
+	MimeType string `json:"mime_type"`
+}
+
+// build the object from the export directory and write what we find
+func inspectWork(namespace string, dirname string, opts importOptions, format string, w io.Writer) error {
+
+	wr := &workReport{Directory: dirname}
+	obj, err := makeEtdObject(namespace, dirname, opts, wr)
+
+	in := inspection{Directory: dirname, Id: wr.Id, Embargo: wr.Embargo, Warnings: wr.Warnings, Diagnostics: wr.Diagnostics}
+	if err != nil {
+		in.Error = err.Error()
+	} else {
+		in.Namespace = obj.Namespace()
+		in.Fields = obj.Fields()
+		if obj.Metadata() != nil {
+			in.Work, err = obj.Metadata().Payload()
+			if err != nil {
+				return err
+			}
+		}
+		for _, b := range obj.Files() {
+			pl, _ := b.Payload()
+			in.Files = append(in.Files, inspectFile{Name: b.Name(), Size: len(pl), MimeType: b.MimeType()})
+		}
+	}
+
+	if format == "json" {
+		buf, err := json.MarshalIndent(in, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(buf))
+		return err
+	}
+	return in.pretty(w)
+}
+
+func (in inspection) pretty(w io.Writer) error {
+
+	fmt.Fprintf(w, "directory: %s\n", in.Directory)
+	fmt.Fprintf(w, "id:        %s/%s\n", in.Namespace, in.Id)
+	if len(in.Error) != 0 {
+		fmt.Fprintf(w, "error:     %s\n", in.Error)
+	}
+
+	if len(in.Work) != 0 {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, in.Work, "  ", "  "); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "\nwork:\n  %s\n", buf.String())
+	}
+
+	if len(in.Fields) != 0 {
+		fmt.Fprintf(w, "\nfields:\n")
+		names := make([]string, 0, len(in.Fields))
+		for k := range in.Fields {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			fmt.Fprintf(w, "  %s = %q\n", k, in.Fields[k])
+		}
+	}
+
+	fmt.Fprintf(w, "\nfiles:\n")
+	for _, f := range in.Files {
+		fmt.Fprintf(w, "  %s (%d bytes, %s)\n", f.Name, f.Size, f.MimeType)
+	}
+	if len(in.Files) == 0 {
+		fmt.Fprintf(w, "  none\n")
+	}
+
+	fmt.Fprintf(w, "\nembargo:\n")
+	for _, e := range in.Embargo {
+		fmt.Fprintf(w, "  %s\n", e)
+	}
+	if len(in.Embargo) == 0 {
+		fmt.Fprintf(w, "  none\n")
+	}
+
+	fmt.Fprintf(w, "\ndiagnostics:\n")
+	for _, d := range in.Diagnostics {
+		fmt.Fprintf(w, "  %s\n", d)
+	}
+	if len(in.Diagnostics) == 0 {
+		fmt.Fprintf(w, "  none\n")
+	}
+
+	fmt.Fprintf(w, "\nwarnings:\n")
+	for _, warning := range in.Warnings {
+		fmt.Fprintf(w, "  %s\n", warning)
+	}
+	if len(in.Warnings) == 0 {
+		fmt.Fprintf(w, "  none\n")
+	}
+	return nil
+}
+
+//
+// end of file
+//
@@ -0,0 +1,62 @@
+//
+// tests for inspect mode
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInspectWork(t *testing.T) {
+
+	dirname := filepath.Join(fixtureDir, "missing-files")
+
+	var js bytes.Buffer
+	if err := inspectWork(goldenNamespace, dirname, goldenOptions(), "json", &js); err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+	var in inspection
+	if err := json.Unmarshal(js.Bytes(), &in); err != nil {
+		t.Fatalf("decoding inspection (%s)", err.Error())
+	}
+	if in.Id != "etd-files-0006" || len(in.Work) == 0 || len(in.Fields) == 0 {
+		t.Errorf("expected the work, got %s", js.String())
+	}
+	if len(in.Files) != 1 || in.Files[0].Name != "present.txt" || in.Files[0].Size == 0 {
+		t.Errorf("expected present.txt, got %+v", in.Files)
+	}
+	if len(in.Warnings) != 2 || in.Warnings[0] != fmt.Sprintf("file not found (%s/absent.pdf), skipping", dirname) {
+		t.Errorf("expected the missing file warnings, got %v", in.Warnings)
+	}
+
+	var text bytes.Buffer
+	if err := inspectWork(goldenNamespace, dirname, goldenOptions(), "text", &text); err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+	for _, line := range []string{"id:        libraetd/etd-files-0006", "present.txt (", fmt.Sprintf("file not found (%s/absent.pdf), skipping", dirname)} {
+		if strings.Contains(text.String(), line) == false {
+			t.Errorf("expected %q in %q", line, text.String())
+		}
+	}
+}
+
+func TestInspectBadWork(t *testing.T) {
+	var text bytes.Buffer
+	err := inspectWork(goldenNamespace, filepath.Join(fixtureDir, "malformed-work"), goldenOptions(), "text", &text)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+	if strings.Contains(text.String(), "error:") == false {
+		t.Errorf("expected the build error, got %q", text.String())
+	}
+}
+
+//
+// end of file
+//
@@ -0,0 +1,492 @@
+//
+// typed decoding of the export JSON. Exports are not always consistent about types so the
+// values are decoded leniently, a string where an array was expected (and the like) is
+// accepted and the coercion is recorded so it can be reported as a warning
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/uvalib/easystore/uvaeasystore"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// implemented by the lenient types, describes any coercions made while decoding
+type coercible interface {
+	coercions() []string
+}
+
+// a string that also accepts numbers, booleans, null and arrays (first value)
+type flexString struct {
+	value    string
+	present  bool   // was a (non-null) value provided
+	coercion string // how the value was coerced (if it was)
+}
+
+// an array of strings that also accepts a single value and null
+type flexStrings struct {
+	values   []string
+	present  bool     // was a (non-null) value provided
+	coercion []string // how the values were coerced (if they were)
+}
+
+// an integer that also accepts a numeric string and null
+type flexInt struct {
+	value    int
+	present  bool   // was a (non-null) value provided
+	coercion string // how the value was coerced (if it was)
+}
+
+// a boolean that also accepts "true"/"false" strings, 0/1 and null
+type flexBool struct {
+	value    bool
+	present  bool   // was a (non-null) value provided
+	coercion string // how the value was coerced (if it was)
+}
+
+func (f *flexString) UnmarshalJSON(buf []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return err
+	}
+	f.present = v != nil
+	f.value, f.coercion = coerceString(v)
+	return nil
+}
+
+func (f flexString) empty() bool {
+	return len(strings.TrimSpace(f.value)) == 0
+}
+
+func (f flexString) coercions() []string {
+	if len(f.coercion) == 0 {
+		return nil
+	}
+	return []string{f.coercion}
+}
+
+func (f *flexStrings) UnmarshalJSON(buf []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return err
+	}
+	f.present = v != nil
+	f.values = make([]string, 0)
+	f.coercion = nil
+
+	switch t := v.(type) {
+	case nil:
+	case []interface{}:
+		for ix, e := range t {
+			str, coercion := coerceString(e)
+			if len(coercion) != 0 {
+				f.coercion = append(f.coercion, fmt.Sprintf("value %d: %s", ix+1, coercion))
+			}
+			f.values = append(f.values, str)
+		}
+	default:
+		str, coercion := coerceString(v)
+		if len(coercion) == 0 {
+			coercion = "single value where an array was expected"
+		}
+		f.coercion = append(f.coercion, coercion)
+		if len(str) != 0 {
+			f.values = append(f.values, str)
+		}
+	}
+	return nil
+}
+
+func (f flexStrings) empty() bool {
+	for _, v := range f.values {
+		if len(strings.TrimSpace(v)) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f flexStrings) coercions() []string {
+	return f.coercion
+}
+
+// the values, never nil
+func (f flexStrings) list() []string {
+	if f.values == nil {
+		return make([]string, 0)
+	}
+	return f.values
+}
+
+// the first value, empty if there are none
+func (f flexStrings) first() string {
+	if len(f.values) == 0 {
+		return ""
+	}
+	return f.values[0]
+}
+
+func (f *flexInt) UnmarshalJSON(buf []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return err
+	}
+	f.present = v != nil
+	f.value = 0
+	f.coercion = ""
+
+	switch t := v.(type) {
+	case nil:
+	case float64:
+		f.value = int(t)
+		if float64(f.value) != t {
+			f.coercion = fmt.Sprintf("number %v is not an integer, using %d", t, f.value)
+		}
+	case string:
+		i, err := strconv.Atoi(strings.TrimSpace(t))
+		if err != nil {
+			f.present = false
+			f.coercion = fmt.Sprintf("string %q where a number was expected, ignoring", t)
+		} else {
+			f.value = i
+			f.coercion = fmt.Sprintf("string %q where a number was expected", t)
+		}
+	default:
+		f.present = false
+		f.coercion = fmt.Sprintf("%s where a number was expected, ignoring", describeJsonType(v))
+	}
+	return nil
+}
+
+func (f flexInt) empty() bool {
+	return f.present == false
+}
+
+func (f flexInt) coercions() []string {
+	if len(f.coercion) == 0 {
+		return nil
+	}
+	return []string{f.coercion}
+}
+
+func (f *flexBool) UnmarshalJSON(buf []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return err
+	}
+	f.present = v != nil
+	f.value = false
+	f.coercion = ""
+
+	switch t := v.(type) {
+	case nil:
+	case bool:
+		f.value = t
+	case float64:
+		if t != 0 && t != 1 {
+			f.present = false
+			f.coercion = fmt.Sprintf("number %v where a boolean was expected, ignoring", t)
+		} else {
+			f.value = t == 1
+			f.coercion = fmt.Sprintf("number %v where a boolean was expected", t)
+		}
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(t))
+		if err != nil {
+			f.present = false
+			f.coercion = fmt.Sprintf("string %q where a boolean was expected, ignoring", t)
+		} else {
+			f.value = b
+			f.coercion = fmt.Sprintf("string %q where a boolean was expected", t)
+		}
+	default:
+		f.present = false
+		f.coercion = fmt.Sprintf("%s where a boolean was expected, ignoring", describeJsonType(v))
+	}
+	return nil
+}
+
+func (f flexBool) empty() bool {
+	return f.present == false
+}
+
+func (f flexBool) coercions() []string {
+	if len(f.coercion) == 0 {
+		return nil
+	}
+	return []string{f.coercion}
+}
+
+// convert the value to a string, returns the string and a description of the coercion
+func coerceString(v interface{}) (string, string) {
+	switch t := v.(type) {
+	case nil:
+		return "", ""
+	case string:
+		return t, ""
+	case float64:
+		str := strconv.FormatFloat(t, 'f', -1, 64)
+		return str, fmt.Sprintf("number %s where a string was expected", str)
+	case bool:
+		str := strconv.FormatBool(t)
+		return str, fmt.Sprintf("boolean %s where a string was expected", str)
+	case []interface{}:
+		if len(t) == 0 {
+			return "", "empty array where a string was expected"
+		}
+		str, _ := coerceString(t[0])
+		if len(t) == 1 {
+			return str, "array where a string was expected"
+		}
+		return str, fmt.Sprintf("array of %d where a string was expected, using the first", len(t))
+	}
+	return "", fmt.Sprintf("%s where a string was expected, ignoring", describeJsonType(v))
+}
+
+// decode the buffer into the typed structure
+func decodeJson(buf []byte, v interface{}) error {
+	if err := json.Unmarshal(buf, v); err != nil {
+		return fmt.Errorf("%q: %w", err.Error(), uvaeasystore.ErrDeserialize)
+	}
+	return nil
+}
+
+// find every coercion made while decoding the structure, each is prefixed with the
+// JSON name of the value
+func findCoercions(v interface{}) []string {
+	return collectCoercions("", reflect.ValueOf(v))
+}
+
+func collectCoercions(prefix string, v reflect.Value) []string {
+
+	result := make([]string, 0)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() == true {
+			return result
+		}
+		v = v.Elem()
+	}
+
+	if c, ok := v.Interface().(coercible); ok == true {
+		for _, coercion := range c.coercions() {
+			result = append(result, fmt.Sprintf("%s: %s", prefix, coercion))
+		}
+		return result
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		for ix := 0; ix < v.NumField(); ix++ {
+			field := v.Type().Field(ix)
+			if field.IsExported() == false {
+				continue
+			}
+			name := prefix
+			if field.Anonymous == false {
+				name = jsonName(prefix, field)
+			}
+			result = append(result, collectCoercions(name, v.Field(ix))...)
+		}
+	case reflect.Slice:
+		for ix := 0; ix < v.Len(); ix++ {
+			result = append(result, collectCoercions(fmt.Sprintf("%s[%d]", prefix, ix), v.Index(ix))...)
+		}
+	}
+	return result
+}
+
+func jsonName(prefix string, field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if len(name) == 0 {
+		name = field.Name
+	}
+	if len(prefix) == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s.%s", prefix, name)
+}
+
+//
+// the export structures
+//
+
+// the work fields common to all the ETD export schemas
+type EtdWorkJson struct {
+	Id                flexString  `json:"id"`
+	Description       flexString  `json:"description"`
+	Department        flexString  `json:"department"`
+	Degree            flexString  `json:"degree"`
+	Keyword           flexStrings `json:"keyword"`
+	Language          flexString  `json:"language"`
+	RelatedUrl        flexStrings `json:"related_url"`
+	DatePublished     flexString  `json:"date_published"`
+	SponsoringAgency  flexStrings `json:"sponsoring_agency"`
+	Notes             flexString  `json:"notes"`
+	Depositor         flexString  `json:"depositor"`
+	AuthorEmail       flexString  `json:"author_email"`
+	AuthorFirstName   flexString  `json:"author_first_name"`
+	AuthorLastName    flexString  `json:"author_last_name"`
+	AuthorInstitution flexString  `json:"author_institution"`
+	EmbargoState      flexString  `json:"embargo_state"`
+	DateCreated       flexString  `json:"date_created"`
+	AdminNotes        flexStrings `json:"admin_notes"`
+	PermanentUrl      flexString  `json:"permanent_url"`
+	WorkSource        flexString  `json:"work_source"`
+	RepresentativeId  flexString  `json:"representative_id"`
+	ThumbnailId       flexString  `json:"thumbnail_id"`
+
+	// embargo details may appear as a separate embargo object or as top level fields
+	Embargo                 flexEmbargo `json:"embargo"`
+	VisibilityDuringEmbargo flexString  `json:"visibility_during_embargo"`
+	VisibilityAfterEmbargo  flexString  `json:"visibility_after_embargo"`
+	EmbargoReleaseDate      flexString  `json:"embargo_release_date"`
+	EmbargoEndDate          flexString  `json:"embargo_end_date"`
+}
+
+type EmbargoJson struct {
+	VisibilityDuring flexString `json:"visibility_during_embargo"`
+	VisibilityAfter  flexString `json:"visibility_after_embargo"`
+	ReleaseDate      flexString `json:"embargo_release_date"`
+}
+
+// the embargo object, anything other than an object is ignored
+type flexEmbargo struct {
+	EmbargoJson
+	present  bool   // was an embargo object provided
+	coercion string // why it was ignored (if it was)
+}
+
+// Hyrax exports, multi-valued title and rights, newline encoded contributors
+type HyraxWorkJson struct {
+	EtdWorkJson
+	Title       flexStrings `json:"title"`
+	Rights      flexStrings `json:"rights"`
+	Contributor flexStrings `json:"contributor"`
+}
+
+// Sufia exports, single valued title and rights, structured contributors
+type SufiaWorkJson struct {
+	EtdWorkJson
+	Title       flexString        `json:"title"`
+	Rights      flexString        `json:"rights"`
+	Contributor sufiaContributors `json:"contributor"`
+}
+
+type SufiaContributorJson struct {
+	Index       flexInt    `json:"index"`
+	ComputingId flexString `json:"computing_id"`
+	FirstName   flexString `json:"first_name"`
+	LastName    flexString `json:"last_name"`
+	Department  flexString `json:"department"`
+	Institution flexString `json:"institution"`
+}
+
+// the Sufia contributor list, entries that are not objects are ignored
+type sufiaContributors struct {
+	list     []SufiaContributorJson
+	coercion []string
+}
+
+// fileset exports, the title is the name of the file in the export directory
+type FilesetJson struct {
+	Id             flexString  `json:"id"`
+	Title          flexStrings `json:"title"`
+	Label          flexString  `json:"label"`             // display label
+	OriginalName   flexString  `json:"original_filename"` // the name the file was uploaded with
+	DateUploaded   flexString  `json:"date_uploaded"`
+	Visibility     flexString  `json:"visibility"`
+	Representative flexBool    `json:"representative"`
+	Thumbnail      flexBool    `json:"thumbnail"`
+
+	// embargo details may appear as a separate embargo object or as top level fields
+	Embargo                 flexEmbargo `json:"embargo"`
+	VisibilityDuringEmbargo flexString  `json:"visibility_during_embargo"`
+	VisibilityAfterEmbargo  flexString  `json:"visibility_after_embargo"`
+	EmbargoReleaseDate      flexString  `json:"embargo_release_date"`
+}
+
+func (f *flexEmbargo) UnmarshalJSON(buf []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return err
+	}
+	f.present = false
+	f.coercion = ""
+	switch v.(type) {
+	case nil:
+	case map[string]interface{}:
+		f.present = true
+		return json.Unmarshal(buf, &f.EmbargoJson)
+	default:
+		f.coercion = fmt.Sprintf("%s where an object was expected, ignoring", describeJsonType(v))
+	}
+	return nil
+}
+
+func (f flexEmbargo) empty() bool {
+	return f.present == false
+}
+
+func (f flexEmbargo) coercions() []string {
+	result := make([]string, 0)
+	if len(f.coercion) != 0 {
+		result = append(result, f.coercion)
+	}
+	result = append(result, findCoercions(f.EmbargoJson)...)
+	return result
+}
+
+func (f *sufiaContributors) UnmarshalJSON(buf []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return err
+	}
+	f.list = make([]SufiaContributorJson, 0)
+	f.coercion = nil
+
+	entries, ok := v.([]interface{})
+	if ok == false {
+		if v == nil {
+			return nil
+		}
+		// a single contributor
+		entries = []interface{}{v}
+		f.coercion = append(f.coercion, "single value where an array was expected")
+	}
+
+	for ix, e := range entries {
+		if _, ok := e.(map[string]interface{}); ok == false {
+			f.coercion = append(f.coercion, fmt.Sprintf("value %d: %s where an object was expected, ignoring", ix+1, describeJsonType(e)))
+			continue
+		}
+		ebuf, _ := json.Marshal(e)
+		var c SufiaContributorJson
+		if err := json.Unmarshal(ebuf, &c); err != nil {
+			return err
+		}
+		f.list = append(f.list, c)
+	}
+	return nil
+}
+
+func (f sufiaContributors) empty() bool {
+	return len(f.list) == 0
+}
+
+func (f sufiaContributors) coercions() []string {
+	result := append([]string{}, f.coercion...)
+	for ix, c := range f.list {
+		for _, coercion := range findCoercions(c) {
+			result = append(result, fmt.Sprintf("value %d: %s", ix+1, coercion))
+		}
+	}
+	return result
+}
+
+//
+// end of file
+//
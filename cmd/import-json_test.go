@@ -0,0 +1,171 @@
+//
+// tests for the lenient JSON decoding
+//
+
+package main
+
+import (
+	"errors"
+	"github.com/uvalib/easystore/uvaeasystore"
+	"slices"
+	"testing"
+)
+
+func TestFlexString(t *testing.T) {
+
+	tests := []struct {
+		json     string
+		value    string
+		present  bool
+		coercion bool
+	}{
+		{`"abc"`, "abc", true, false},
+		{`null`, "", false, false},
+		{`12.5`, "12.5", true, true},
+		{`true`, "true", true, true},
+		{`["abc"]`, "abc", true, true},
+		{`["abc", "def"]`, "abc", true, true},
+		{`[]`, "", true, true},
+		{`{"a": "b"}`, "", true, true},
+	}
+
+	for _, test := range tests {
+		var f flexString
+		if err := decodeJson([]byte(test.json), &f); err != nil {
+			t.Fatalf("%s: unexpected error (%s)", test.json, err.Error())
+		}
+		if f.value != test.value || f.present != test.present || (len(f.coercion) != 0) != test.coercion {
+			t.Errorf("%s: got %q present %t coercion %q", test.json, f.value, f.present, f.coercion)
+		}
+	}
+}
+
+func TestFlexStrings(t *testing.T) {
+
+	tests := []struct {
+		json      string
+		values    []string
+		coercions int
+	}{
+		{`["a", "b"]`, []string{"a", "b"}, 0},
+		{`null`, []string{}, 0},
+		{`"a"`, []string{"a"}, 1},
+		{`""`, []string{}, 1},
+		{`[1, "b", false]`, []string{"1", "b", "false"}, 2},
+	}
+
+	for _, test := range tests {
+		var f flexStrings
+		if err := decodeJson([]byte(test.json), &f); err != nil {
+			t.Fatalf("%s: unexpected error (%s)", test.json, err.Error())
+		}
+		if slices.Equal(f.list(), test.values) == false || len(f.coercions()) != test.coercions {
+			t.Errorf("%s: got %v coercions %v", test.json, f.list(), f.coercions())
+		}
+	}
+}
+
+func TestFlexInt(t *testing.T) {
+
+	tests := []struct {
+		json     string
+		value    int
+		present  bool
+		coercion bool
+	}{
+		{`3`, 3, true, false},
+		{`null`, 0, false, false},
+		{`"4"`, 4, true, true},
+		{`"four"`, 0, false, true},
+		{`2.5`, 2, true, true},
+		{`[1]`, 0, false, true},
+	}
+
+	for _, test := range tests {
+		var f flexInt
+		if err := decodeJson([]byte(test.json), &f); err != nil {
+			t.Fatalf("%s: unexpected error (%s)", test.json, err.Error())
+		}
+		if f.value != test.value || f.present != test.present || (len(f.coercion) != 0) != test.coercion {
+			t.Errorf("%s: got %d present %t coercion %q", test.json, f.value, f.present, f.coercion)
+		}
+	}
+}
+
+func TestFlexBool(t *testing.T) {
+
+	tests := []struct {
+		json     string
+		value    bool
+		present  bool
+		coercion bool
+	}{
+		{`true`, true, true, false},
+		{`null`, false, false, false},
+		{`"false"`, false, true, true},
+		{`"yes"`, false, false, true},
+		{`1`, true, true, true},
+		{`2`, false, false, true},
+		{`[true]`, false, false, true},
+	}
+
+	for _, test := range tests {
+		var f flexBool
+		if err := decodeJson([]byte(test.json), &f); err != nil {
+			t.Fatalf("%s: unexpected error (%s)", test.json, err.Error())
+		}
+		if f.value != test.value || f.present != test.present || (len(f.coercion) != 0) != test.coercion {
+			t.Errorf("%s: got %t present %t coercion %q", test.json, f.value, f.present, f.coercion)
+		}
+	}
+}
+
+func TestFindCoercions(t *testing.T) {
+
+	work := SufiaWorkJson{}
+	buf := `{"id": 7, "title": ["A"], "keyword": "k", "embargo": {"embargo_release_date": 2020},
+		"contributor": [{"index": "1", "first_name": "A"}, "bad"]}`
+	if err := decodeJson([]byte(buf), &work); err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+
+	expected := []string{
+		"id: number 7 where a string was expected",
+		"keyword: single value where an array was expected",
+		"embargo: embargo_release_date: number 2020 where a string was expected",
+		"title: array where a string was expected",
+		"contributor: value 2: string where an object was expected, ignoring",
+		"contributor: value 1: index: string \"1\" where a number was expected",
+	}
+	if found := findCoercions(work); slices.Equal(found, expected) == false {
+		t.Errorf("expected %q, got %q", expected, found)
+	}
+	if work.Id.value != "7" || work.Title.value != "A" || len(work.Contributor.list) != 1 {
+		t.Errorf("unexpected values %+v", work)
+	}
+}
+
+func TestDecodeJsonError(t *testing.T) {
+	work := EtdWorkJson{}
+	err := decodeJson([]byte(`{"id": `), &work)
+	if errors.Is(err, uvaeasystore.ErrDeserialize) == false {
+		t.Errorf("expected a deserialize error, got %v", err)
+	}
+}
+
+func TestExtractName(t *testing.T) {
+	name, coercions, err := extractName([]byte(`{"title": "file.pdf"}`))
+	if err != nil || name != "file.pdf" || len(coercions) != 1 {
+		t.Errorf("got %q %v (%v)", name, coercions, err)
+	}
+
+	// a corrupt fileset is an error, not an empty name
+	_, _, err = extractName([]byte(`{"title": [`))
+	if errors.Is(err, uvaeasystore.ErrDeserialize) == false {
+		t.Errorf("expected a deserialize error, got %v", err)
+	}
+}
+
+//
+// end of file
+//
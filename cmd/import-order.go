@@ -0,0 +1,159 @@
+//
+// deterministic ordering of the work list and sharding it between importer instances
+//
+
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// the work ordering options
+var sortPolicies = []string{"name", "date_created", "size", "archive"}
+
+// the details we order and shard works by
+type workOrder struct {
+	dirname string // the work directory
+	name    string // directory relative to the import root
+	id      string // work identifier (if available)
+	created string // work creation date (YYYY-MM-DDTHH:MM:SSZ, if available)
+	size    int64  // total size of the files in the work directory
+	pos     int    // position within the source (archive order), -1 if unknown
+}
+
+// a shard specification, index i of n (0 <= i < n). A zero count means no sharding
+type workShard struct {
+	index int
+	count int
+}
+
+// parse the shard specification (i/n), an empty specification means no sharding
+func parseShard(str string) (workShard, error) {
+	if len(str) == 0 {
+		return workShard{}, nil
+	}
+	bad := fmt.Errorf("bad shard (%s), must be i/n where 0 <= i < n", str)
+	is, ns, found := strings.Cut(str, "/")
+	if found == false {
+		return workShard{}, bad
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(is))
+	if err != nil {
+		return workShard{}, bad
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(ns))
+	if err != nil || n < 1 || i < 0 || i >= n {
+		return workShard{}, bad
+	}
+	return workShard{index: i, count: n}, nil
+}
+
+func (s workShard) String() string {
+	if s.count == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", s.index, s.count)
+}
+
+// does this shard own the work. Assignment is by a hash of the work id so it does not
+// depend on the directory layout or the order the works are listed in
+func (s workShard) owns(wo workOrder) bool {
+	if s.count == 0 {
+		return true
+	}
+	key := wo.id
+	if len(key) == 0 {
+		key = wo.name
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32()%uint32(s.count)) == s.index
+}
+
+// order the work directories, the name is always used to break ties so the order is
+// the same each time we see the same export
+func orderWorks(root string, dirs []string, sortBy string) []workOrder {
+
+	works := make([]workOrder, 0, len(dirs))
+	for _, dirname := range dirs {
+		works = append(works, summarizeOrder(root, dirname))
+	}
+
+	sort.SliceStable(works, func(i, j int) bool {
+		a, b := works[i], works[j]
+		switch sortBy {
+		case "date_created":
+			// works without a date go last
+			if a.created != b.created {
+				if len(a.created) == 0 || len(b.created) == 0 {
+					return len(b.created) == 0
+				}
+				return a.created < b.created
+			}
+		case "size":
+			if a.size != b.size {
+				return a.size < b.size
+			}
+		case "archive":
+			if a.pos != b.pos {
+				return a.pos < b.pos
+			}
+		}
+		return a.name < b.name
+	})
+	return works
+}
+
+// the works owned by the shard
+func shardWorks(works []workOrder, shard workShard) []string {
+	dirs := make([]string, 0, len(works))
+	for _, wo := range works {
+		if shard.owns(wo) == true {
+			dirs = append(dirs, wo.dirname)
+		}
+	}
+	return dirs
+}
+
+// get the ordering details for the work, works we cannot read are ordered by name
+// and reported when we attempt to import them
+func summarizeOrder(root string, dirname string) workOrder {
+
+	wo := workOrder{dirname: dirname, name: relativePath(root, dirname), pos: -1}
+	if ss, ok := inputSource.(sequentialSource); ok == true {
+		wo.pos = ss.dirOrder(dirname)
+	}
+
+	entries, err := inputSource.readDir(dirname)
+	if err == nil {
+		for _, e := range entries {
+			if e.isDir == false {
+				wo.size += e.size
+			}
+		}
+	}
+
+	buf, err := loadFile(fmt.Sprintf("%s/work.json", dirname))
+	if err != nil {
+		return wo
+	}
+	work := EtdWorkJson{}
+	if err = decodeJson(buf, &work); err != nil {
+		return wo
+	}
+	wo.id = work.Id.value
+
+	// the exports use several date formats so they are normalized before they are compared
+	if len(work.DateCreated.value) != 0 {
+		wo.created = cleanupDate(work.DateCreated.value)
+	}
+	return wo
+}
+
+//
+// end of file
+//
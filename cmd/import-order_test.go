@@ -0,0 +1,140 @@
+//
+// tests for work ordering and sharding
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func fixtureWorks(t *testing.T) []string {
+	items, err := os.ReadDir(fixtureDir)
+	if err != nil {
+		t.Fatalf("listing fixtures (%s)", err.Error())
+	}
+	dirs := make([]string, 0)
+	for _, i := range items {
+		if i.IsDir() == true {
+			dirs = append(dirs, filepath.Join(fixtureDir, i.Name()))
+		}
+	}
+	return dirs
+}
+
+func TestParseShard(t *testing.T) {
+	good := map[string]workShard{
+		"":    {},
+		"0/1": {index: 0, count: 1},
+		"2/4": {index: 2, count: 4},
+	}
+	for str, expected := range good {
+		shard, err := parseShard(str)
+		if err != nil || shard != expected {
+			t.Errorf("%q: expected %v, got %v (%v)", str, expected, shard, err)
+		}
+	}
+	for _, str := range []string{"1", "4/4", "-1/4", "1/0", "a/b"} {
+		if _, err := parseShard(str); err == nil {
+			t.Errorf("%q: expected an error", str)
+		}
+	}
+}
+
+func TestOrderWorks(t *testing.T) {
+
+	dirs := fixtureWorks(t)
+	slices.Reverse(dirs)
+
+	names := func(works []workOrder) []string {
+		result := make([]string, 0, len(works))
+		for _, wo := range works {
+			result = append(result, wo.name)
+		}
+		return result
+	}
+
+	byName := names(orderWorks(fixtureDir, dirs, "name"))
+	if slices.IsSorted(byName) == false {
+		t.Errorf("expected name order, got %v", byName)
+	}
+
+	byDate := orderWorks(fixtureDir, dirs, "date_created")
+	if byDate[0].name != "odd-dates" {
+		t.Errorf("expected the oldest work first, got %v", names(byDate))
+	}
+	for ix := 1; ix < len(byDate); ix++ {
+		if len(byDate[ix].created) != 0 && byDate[ix-1].created > byDate[ix].created {
+			t.Errorf("expected date order, got %v", names(byDate))
+		}
+	}
+
+	bySize := orderWorks(fixtureDir, dirs, "size")
+	for ix := 1; ix < len(bySize); ix++ {
+		if bySize[ix-1].size > bySize[ix].size {
+			t.Errorf("expected size order, got %v", names(bySize))
+		}
+	}
+}
+
+// every work belongs to exactly one shard, whatever order we see them in
+// the creation dates are compared as dates, not as they appear in the export
+func TestOrderWorksMixedDates(t *testing.T) {
+
+	root := t.TempDir()
+	dates := map[string]string{"a": `"May 1, 2009"`, "b": `"2011-04-04T10:00:00Z"`, "c": `"2010"`, "d": `null`, "e": `"03/15/2010"`}
+	dirs := make([]string, 0)
+	for name, date := range dates {
+		dirname := filepath.Join(root, name)
+		if err := os.Mkdir(dirname, 0755); err != nil {
+			t.Fatalf("creating work (%s)", err.Error())
+		}
+		work := fmt.Sprintf(`{"id": %q, "date_created": %s}`, name, date)
+		if err := os.WriteFile(filepath.Join(dirname, "work.json"), []byte(work), 0644); err != nil {
+			t.Fatalf("writing work (%s)", err.Error())
+		}
+		dirs = append(dirs, dirname)
+	}
+
+	got := make([]string, 0)
+	for _, wo := range orderWorks(root, dirs, "date_created") {
+		got = append(got, wo.name)
+	}
+	if expected := []string{"a", "c", "e", "b", "d"}; slices.Equal(got, expected) == false {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestShardWorks(t *testing.T) {
+
+	dirs := fixtureWorks(t)
+	works := orderWorks(fixtureDir, dirs, "name")
+
+	seen := make(map[string]int)
+	for ix := 0; ix < 3; ix++ {
+		for _, dirname := range shardWorks(works, workShard{index: ix, count: 3}) {
+			seen[dirname]++
+		}
+	}
+	for _, dirname := range dirs {
+		if seen[dirname] != 1 {
+			t.Errorf("%s: expected to be in one shard, found in %d", dirname, seen[dirname])
+		}
+	}
+
+	slices.Reverse(dirs)
+	reversed := shardWorks(orderWorks(fixtureDir, dirs, "size"), workShard{index: 1, count: 3})
+	forward := shardWorks(works, workShard{index: 1, count: 3})
+	slices.Sort(reversed)
+	if slices.Equal(reversed, forward) == false {
+		t.Errorf("shard assignment depends on order, %v vs %v", forward, reversed)
+	}
+}
+
+//
+// end of file
+//
@@ -0,0 +1,145 @@
+//
+// the run report, a record of what happened to each work during an import run
+//
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// work status values
+const (
+	workImported  = "imported"
+	workProcessed = "processed" // dry run
+	workSkipped   = "skipped"
+	workError     = "error"
+)
+
+// the import run, recorded with each work we import
+type importRun struct {
+	id      string    // run identifier
+	version string    // importer version
+	root    string    // the import directory (or archive), work paths are relative to it
+	export  string    // the export location we record, absolute for local sources
+	started time.Time // when the run started, recorded as the import date
+}
+
+type runReport struct {
+	RunId    string    `json:"run_id"`
+	Version  string    `json:"version"` // importer version
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	AsOf     time.Time `json:"as_of"` // reference time for time dependent decisions
+	DryRun   bool      `json:"dry_run"`
+	Sort     string    `json:"sort"`            // work ordering
+	Shard    string    `json:"shard,omitempty"` // the shard we imported (i/n)
+	OkCount  int       `json:"ok_count"`
+	Skipped  int       `json:"skip_count"`
+	Errors   int       `json:"error_count"`
+	// diagnostic counts by severity
+	Diagnostics map[string]int `json:"diagnostics"`
+	// objects from failed batches that could not be deleted again
+	Remaining []string      `json:"remaining,omitempty"`
+	Works     []*workReport `json:"works"`
+}
+
+type workReport struct {
+	Directory string   `json:"directory"`          // source directory
+	Id        string   `json:"id,omitempty"`       // work identifier
+	Schema    string   `json:"schema,omitempty"`   // the export schema
+	Status    string   `json:"status"`             // what happened
+	Reason    string   `json:"reason,omitempty"`   // why (for skipped and errored works)
+	Embargo   []string `json:"embargo,omitempty"`  // how the visibility was determined
+	Warnings  []string `json:"warnings,omitempty"` // warnings raised while building the object
+	// problems found with the work metadata
+	Diagnostics []workDiagnostic `json:"diagnostics,omitempty"`
+}
+
+func newRunReport(dryRun bool, asOf time.Time) *runReport {
+	return &runReport{
+		Started: time.Now(),
+		AsOf:    asOf,
+		DryRun:  dryRun,
+		Works:   make([]*workReport, 0),
+	}
+}
+
+// create the import run, a run identifier is generated if one is not specified. A local
+// import directory is recorded as an absolute path so the export can be found again
+func newImportRun(id string, root string, started time.Time) importRun {
+	run := importRun{id: id, version: buildVersion(), root: root, export: root, started: started.UTC()}
+	if isS3Location(root) == false {
+		if abs, err := filepath.Abs(root); err == nil {
+			run.export = abs
+		}
+	}
+	if len(run.id) == 0 {
+		b := make([]byte, 3)
+		rand.Read(b)
+		run.id = fmt.Sprintf("%s-%s", run.started.Format("20060102T150405Z"), hex.EncodeToString(b))
+	}
+	return run
+}
+
+// add a new work to the report
+func (r *runReport) newWork(dirname string) *workReport {
+	wr := &workReport{Directory: dirname}
+	r.Works = append(r.Works, wr)
+	return wr
+}
+
+// finish the report, record the final counts
+func (r *runReport) finish(okCount int, skipCount int, errCount int) {
+	r.Finished = time.Now()
+	r.OkCount = okCount
+	r.Skipped = skipCount
+	r.Errors = errCount
+	r.Diagnostics = make(map[string]int)
+	for _, wr := range r.Works {
+		countDiagnostics(r.Diagnostics, wr.Diagnostics)
+	}
+}
+
+// write the report to the specified file
+func (r *runReport) write(filename string) error {
+	buf, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, buf, 0644)
+}
+
+// mark the work as failed
+func (wr *workReport) failed(err error) {
+	wr.Status = workError
+	wr.Reason = err.Error()
+}
+
+// log a warning raised while building the work and keep it with the work, a nil report
+// just logs it
+func (wr *workReport) logWarning(msg string) {
+	logWarning(msg)
+	if wr != nil {
+		wr.Warnings = append(wr.Warnings, msg)
+	}
+}
+
+// log an error raised while building the work and keep it with the work, a nil report
+// just logs it
+func (wr *workReport) logError(msg string) {
+	logError(msg)
+	if wr != nil {
+		wr.Warnings = append(wr.Warnings, msg)
+	}
+}
+
+//
+// end of file
+//
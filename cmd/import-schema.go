@@ -0,0 +1,110 @@
+//
+// export schema detection, the shape of work.json depends on the system that produced it
+//
+
+package main
+
+import (
+	"fmt"
+	"github.com/uvalib/easystore/uvaeasystore"
+	"strings"
+)
+
+// the export schemas we understand
+const (
+	schemaHyraxEtd = "hyrax-etd" // Libra ETD (Hyrax), multi-valued title, newline encoded contributors
+	schemaSufiaEtd = "sufia-etd" // older Libra ETD (Sufia), single valued title, structured contributors
+)
+
+// an exporter may identify the schema explicitly with this key
+var schemaMarker = "schema_version"
+
+// determine the export schema of the work. An explicit marker is used when present (the value
+// starts with the schema name, for example hyrax-etd/2), otherwise we look at the contributor
+// encoding. The title is decoded leniently so its shape only breaks the tie for works without
+// contributors, a missing or odd title is left to the metadata diagnostics
+func detectSchema(omap map[string]interface{}) (string, error) {
+
+	if marker, found := omap[schemaMarker]; found == true {
+		str, ok := marker.(string)
+		if ok == true {
+			for _, schema := range []string{schemaHyraxEtd, schemaSufiaEtd} {
+				if str == schema || strings.HasPrefix(str, schema+"/") == true {
+					return schema, nil
+				}
+			}
+		}
+		return "", fmt.Errorf("%q: %w", fmt.Sprintf("unrecognized export schema (%s %v)", schemaMarker, marker), uvaeasystore.ErrDeserialize)
+	}
+
+	// the contributor encodings differ between the schemas, works without contributors
+	// are Sufia when the title is a single value and Hyrax (the original mapping) otherwise
+	switch contributorEncoding(omap["contributor"]) {
+	case "":
+		if _, ok := omap["title"].(string); ok == true {
+			return schemaSufiaEtd, nil
+		}
+		return schemaHyraxEtd, nil
+	case "string":
+		return schemaHyraxEtd, nil
+	case "object":
+		return schemaSufiaEtd, nil
+	}
+
+	return "", fmt.Errorf("%q: %w", fmt.Sprintf("unrecognized export schema (contributors %s)",
+		describeJsonType(omap["contributor"])), uvaeasystore.ErrDeserialize)
+}
+
+// how the contributors are encoded, string or object, empty if there are none and
+// mixed if we cannot tell. A single value is treated as a list of one
+func contributorEncoding(i interface{}) string {
+	if i == nil {
+		return ""
+	}
+	array, ok := i.([]interface{})
+	if ok == false {
+		array = []interface{}{i}
+	}
+
+	encoding := ""
+	for _, c := range array {
+		e := "mixed"
+		switch c.(type) {
+		case string:
+			e = "string"
+		case map[string]interface{}:
+			e = "object"
+		}
+		if len(encoding) != 0 && e != encoding {
+			return "mixed"
+		}
+		encoding = e
+	}
+	return encoding
+}
+
+// a short description of the JSON value type for error messages
+func describeJsonType(i interface{}) string {
+	switch t := i.(type) {
+	case nil:
+		return "missing"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		if len(t) != 0 {
+			return fmt.Sprintf("array of %s", describeJsonType(t[0]))
+		}
+		return "empty array"
+	}
+	return "unknown"
+}
+
+//
+// end of file
+//
@@ -0,0 +1,62 @@
+//
+// tests for export schema detection
+//
+
+package main
+
+import (
+	"errors"
+	"github.com/uvalib/easystore/uvaeasystore"
+	"testing"
+)
+
+func TestDetectSchema(t *testing.T) {
+
+	tests := []struct {
+		work     string
+		expected string
+	}{
+		{`{"title": ["A"], "contributor": ["0\nabc\nA\nB\nDept\nUVA"]}`, schemaHyraxEtd},
+		{`{"title": ["A"]}`, schemaHyraxEtd},
+		{`{"title": "A", "contributor": [{"index": 0}]}`, schemaSufiaEtd},
+		{`{"title": "A", "contributor": {"index": 0}}`, schemaSufiaEtd},
+		{`{"title": "A", "schema_version": "hyrax-etd/2"}`, schemaHyraxEtd},
+		{`{"title": ["A"], "schema_version": "sufia-etd"}`, schemaSufiaEtd},
+
+		// the title only decides the schema when there are no contributors
+		{`{"title": "A", "contributor": ["0\nabc"]}`, schemaHyraxEtd},
+		{`{"title": ["A"], "contributor": [{"index": 0}]}`, schemaSufiaEtd},
+		{`{"title": "A"}`, schemaSufiaEtd},
+		{`{"title": "A", "contributor": []}`, schemaSufiaEtd},
+		{`{"description": "no title", "contributor": ["0\nabc"]}`, schemaHyraxEtd},
+		{`{"title": null}`, schemaHyraxEtd},
+		{`{"title": 42, "contributor": []}`, schemaHyraxEtd},
+
+		// unrecognized
+		{`{"title": ["A"], "schema_version": "hyku-etd/1"}`, ""},
+		{`{"title": ["A"], "schema_version": 2}`, ""},
+		{`{"title": ["A"], "contributor": ["0\nabc", {"index": 0}]}`, ""},
+		{`{"title": ["A"], "contributor": [42]}`, ""},
+	}
+
+	for _, test := range tests {
+		omap, err := interfaceToMap([]byte(test.work))
+		if err != nil {
+			t.Fatalf("%s: bad test (%s)", test.work, err.Error())
+		}
+		schema, err := detectSchema(omap)
+		if len(test.expected) == 0 {
+			if errors.Is(err, uvaeasystore.ErrDeserialize) == false {
+				t.Errorf("%s: expected an unrecognized schema, got %q (%v)", test.work, schema, err)
+			}
+			continue
+		}
+		if err != nil || schema != test.expected {
+			t.Errorf("%s: expected %q, got %q (%v)", test.work, test.expected, schema, err)
+		}
+	}
+}
+
+//
+// end of file
+//
@@ -0,0 +1,473 @@
+//
+// archive import source, reads works directly from a tar, tar.gz or zip export
+// without extracting it to disk
+//
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// the archive types we support
+const (
+	archiveTar = "tar"
+	archiveTgz = "tgz"
+	archiveZip = "zip"
+)
+
+type archiveEntry struct {
+	order  int       // position within the archive
+	offset int64     // data offset (uncompressed tar only)
+	size   int64     // file size
+	zf     *zip.File // zip file entry (zip only)
+	hash   string    // content hash (compressed tar only)
+	data   []byte    // work and fileset metadata contents (compressed tar only)
+}
+
+type archiveSource struct {
+	location string                            // the archive filename, our root
+	kind     string                            // the archive type
+	prefix   string                            // wrapper directory within the archive (if any)
+	files    map[string]*archiveEntry          // archive path -> file details
+	dirs     map[string]map[string]sourceEntry // archive path -> directory contents
+
+	f  *os.File        // the open archive (tar and tgz)
+	zr *zip.ReadCloser // the open archive (zip)
+
+	// compressed tar files can only be read sequentially. The metadata and the file hashes
+	// are kept when we index the archive, the files are read a directory at a time (works
+	// are imported in archive order) and we restart from the beginning if we go backwards
+	gz       *gzip.Reader
+	stream   *tar.Reader
+	position int               // order of the next entry in the stream
+	restarts int               // how many times we went back to the beginning
+	cacheDir string            // the directory we have cached
+	cache    map[string][]byte // cached file contents
+}
+
+// a reader that tracks the position so we know where the tar entries start
+type positionReader struct {
+	f   *os.File
+	pos int64
+}
+
+func isArchive(location string) bool {
+	return len(archiveKind(location)) != 0
+}
+
+func archiveKind(location string) string {
+	l := strings.ToLower(location)
+	switch {
+	case strings.HasSuffix(l, ".tar"):
+		return archiveTar
+	case strings.HasSuffix(l, ".tar.gz"), strings.HasSuffix(l, ".tgz"):
+		return archiveTgz
+	case strings.HasSuffix(l, ".zip"):
+		return archiveZip
+	}
+	return ""
+}
+
+func newArchiveSource(location string) (*archiveSource, error) {
+
+	impl := &archiveSource{
+		location: location,
+		kind:     archiveKind(location),
+		files:    make(map[string]*archiveEntry),
+		dirs:     make(map[string]map[string]sourceEntry),
+	}
+	impl.dirs[""] = make(map[string]sourceEntry)
+
+	var err error
+	if impl.kind == archiveZip {
+		err = impl.indexZip()
+	} else {
+		err = impl.indexTar()
+	}
+	if err != nil {
+		impl.close()
+		return nil, err
+	}
+
+	// exports are often wrapped in a single top level directory, if so, use it as the root
+	top := impl.dirs[""]
+	if len(top) == 1 {
+		for name, e := range top {
+			if e.isDir == true && impl.files[path.Join(name, "work.json")] == nil {
+				impl.prefix = name
+			}
+		}
+	}
+
+	logInfo(fmt.Sprintf("indexed %d file(s) in %s", len(impl.files), location))
+	return impl, nil
+}
+
+func (impl *archiveSource) readDir(dirname string) ([]sourceEntry, error) {
+	contents, found := impl.dirs[impl.archivePath(dirname)]
+	if found == false {
+		return nil, &fs.PathError{Op: "readdir", Path: dirname, Err: fs.ErrNotExist}
+	}
+	entries := make([]sourceEntry, 0, len(contents))
+	for _, e := range contents {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries, nil
+}
+
+func (impl *archiveSource) readFile(filename string) ([]byte, error) {
+
+	name := impl.archivePath(filename)
+	entry, found := impl.files[name]
+	if found == false {
+		return nil, &fs.PathError{Op: "open", Path: filename, Err: fs.ErrNotExist}
+	}
+
+	switch impl.kind {
+	case archiveZip:
+		r, err := entry.zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+
+	case archiveTar:
+		buf := make([]byte, entry.size)
+		_, err := impl.f.ReadAt(buf, entry.offset)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		return buf, nil
+	}
+
+	// compressed tar
+	if entry.data != nil {
+		return entry.data, nil
+	}
+	if err := impl.loadDir(path.Dir(name)); err != nil {
+		return nil, err
+	}
+	return impl.cache[name], nil
+}
+
+func (impl *archiveSource) open(filename string) (io.ReadCloser, error) {
+
+	name := impl.archivePath(filename)
+	entry, found := impl.files[name]
+	if found == false {
+		return nil, &fs.PathError{Op: "open", Path: filename, Err: fs.ErrNotExist}
+	}
+
+	switch impl.kind {
+	case archiveZip:
+		return entry.zf.Open()
+	case archiveTar:
+		return io.NopCloser(io.NewSectionReader(impl.f, entry.offset, entry.size)), nil
+	}
+
+	buf, err := impl.readFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(buf)), nil
+}
+
+func (impl *archiveSource) exists(filename string) bool {
+	name := impl.archivePath(filename)
+	if _, found := impl.files[name]; found == true {
+		return true
+	}
+	_, found := impl.dirs[name]
+	return found
+}
+
+func (impl *archiveSource) close() error {
+	if impl.gz != nil {
+		impl.gz.Close()
+	}
+	if impl.zr != nil {
+		return impl.zr.Close()
+	}
+	if impl.f != nil {
+		return impl.f.Close()
+	}
+	return nil
+}
+
+// the content hash of the file, compressed tar files are hashed when they are indexed
+func (impl *archiveSource) fileHash(filename string) (string, bool) {
+	entry, found := impl.files[impl.archivePath(filename)]
+	if found == false || len(entry.hash) == 0 {
+		return "", false
+	}
+	return entry.hash, true
+}
+
+// the order of the directory within the archive (that of its first file), -1 if it
+// has no files
+func (impl *archiveSource) dirOrder(dirname string) int {
+	dir := impl.archivePath(dirname)
+	first := -1
+	for name := range impl.dirs[dir] {
+		if e, found := impl.files[path.Join(dir, name)]; found == true && (first == -1 || e.order < first) {
+			first = e.order
+		}
+	}
+	return first
+}
+
+// can the archive only be read sequentially
+func (impl *archiveSource) sequential() bool {
+	return impl.kind == archiveTgz
+}
+
+// convert the source path to the path within the archive
+func (impl *archiveSource) archivePath(filename string) string {
+	return path.Join(impl.prefix, relativePath(impl.location, filename))
+}
+
+// the normalized name of an archive entry, absolute names are treated as relative to the
+// archive. The archive itself and names outside of it are not usable
+func entryName(raw string) (string, bool) {
+	name := path.Clean(strings.TrimLeft(raw, "/"))
+	if name == "." {
+		return "", false
+	}
+	if name == ".." || strings.HasPrefix(name, "../") == true {
+		return name, false
+	}
+	return name, true
+}
+
+// add a file (or directory) and any parent directories to the index
+func (impl *archiveSource) addEntry(raw string, isDir bool, entry *archiveEntry) {
+
+	name, ok := entryName(raw)
+	if ok == false {
+		if len(name) != 0 {
+			logWarning(fmt.Sprintf("archive entry %s is outside the archive, ignoring", raw))
+		}
+		return
+	}
+
+	if isDir == false {
+		impl.files[name] = entry
+	} else if _, found := impl.dirs[name]; found == false {
+		impl.dirs[name] = make(map[string]sourceEntry)
+	}
+
+	// and make sure we have all the parents
+	child := sourceEntry{name: path.Base(name), isDir: isDir}
+	if entry != nil {
+		child.size = entry.size
+	}
+	for {
+		parent := path.Dir(name)
+		if parent == "." {
+			parent = ""
+		}
+		if _, found := impl.dirs[parent]; found == false {
+			impl.dirs[parent] = make(map[string]sourceEntry)
+		}
+		impl.dirs[parent][child.name] = child
+		if len(parent) == 0 || parent == name {
+			break
+		}
+		name = parent
+		child = sourceEntry{name: path.Base(parent), isDir: true}
+	}
+}
+
+func (impl *archiveSource) indexZip() error {
+	var err error
+	impl.zr, err = zip.OpenReader(impl.location)
+	if err != nil {
+		return err
+	}
+	for ix, zf := range impl.zr.File {
+		isDir := zf.FileInfo().IsDir()
+		var entry *archiveEntry
+		if isDir == false {
+			entry = &archiveEntry{order: ix, size: int64(zf.UncompressedSize64), zf: zf}
+		}
+		impl.addEntry(zf.Name, isDir, entry)
+	}
+	return nil
+}
+
+func (impl *archiveSource) indexTar() error {
+	var err error
+	impl.f, err = os.Open(impl.location)
+	if err != nil {
+		return err
+	}
+
+	pr := &positionReader{f: impl.f}
+	var tr *tar.Reader
+	if impl.kind == archiveTgz {
+		gz, err := gzip.NewReader(pr)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		tr = tar.NewReader(gz)
+	} else {
+		tr = tar.NewReader(pr)
+	}
+
+	for ix := 0; ; ix++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s (%s)", impl.location, err.Error())
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			impl.addEntry(hdr.Name, true, nil)
+		case tar.TypeReg:
+			entry := &archiveEntry{order: ix, offset: pr.pos, size: hdr.Size}
+			if impl.kind == archiveTgz {
+				if err = readTarEntry(tr, hdr.Name, entry); err != nil {
+					return fmt.Errorf("reading %s (%s)", impl.location, err.Error())
+				}
+			}
+			impl.addEntry(hdr.Name, false, entry)
+		}
+	}
+	return nil
+}
+
+// hash the current compressed tar entry and keep its contents if it is work or fileset
+// metadata, we need them for every work before we import anything
+func readTarEntry(tr *tar.Reader, name string, entry *archiveEntry) error {
+	h := sha256.New()
+	var w io.Writer = h
+	var buf *bytes.Buffer
+	if isMetadataFile(name) == true {
+		buf = &bytes.Buffer{}
+		w = io.MultiWriter(h, buf)
+	}
+	if _, err := io.Copy(w, tr); err != nil {
+		return err
+	}
+	entry.hash = hex.EncodeToString(h.Sum(nil))
+	if buf != nil {
+		entry.data = buf.Bytes()
+	}
+	return nil
+}
+
+// the work and fileset metadata files
+func isMetadataFile(name string) bool {
+	base := path.Base(name)
+	return base == "work.json" || (strings.HasPrefix(base, "fileset-") == true && strings.HasSuffix(base, ".json") == true)
+}
+
+// read the files in the directory from a compressed tar (other than the metadata we
+// already have), we cache one directory at a time, which is all we need to build an object
+func (impl *archiveSource) loadDir(dir string) error {
+
+	if impl.cache != nil && impl.cacheDir == dir {
+		return nil
+	}
+
+	// which files do we need and where is the first one
+	needed := 0
+	first := -1
+	for name := range impl.dirs[dir] {
+		e, found := impl.files[path.Join(dir, name)]
+		if found == true && e.data == nil {
+			needed++
+			if first == -1 || e.order < first {
+				first = e.order
+			}
+		}
+	}
+	if needed == 0 {
+		impl.cacheDir = dir
+		impl.cache = make(map[string][]byte)
+		return nil
+	}
+
+	// do we need to start from the beginning
+	if impl.stream == nil || first < impl.position {
+		if impl.gz != nil {
+			impl.gz.Close()
+			impl.restarts++
+		}
+		if _, err := impl.f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		gz, err := gzip.NewReader(impl.f)
+		if err != nil {
+			return err
+		}
+		impl.gz = gz
+		impl.stream = tar.NewReader(gz)
+		impl.position = 0
+	}
+
+	cache := make(map[string][]byte)
+	for len(cache) < needed {
+		hdr, err := impl.stream.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s (%s)", impl.location, err.Error())
+		}
+		impl.position++
+
+		name, ok := entryName(hdr.Name)
+		if ok == false || hdr.Typeflag != tar.TypeReg || path.Dir(name) != dir {
+			continue
+		}
+		if e, found := impl.files[name]; found == true && e.data == nil {
+			buf, err := io.ReadAll(impl.stream)
+			if err != nil {
+				return err
+			}
+			cache[name] = buf
+		}
+	}
+
+	impl.cacheDir = dir
+	impl.cache = cache
+	return nil
+}
+
+func (pr *positionReader) Read(p []byte) (int, error) {
+	n, err := pr.f.Read(p)
+	pr.pos += int64(n)
+	return n, err
+}
+
+// allows the tar reader to skip over file contents without reading them
+func (pr *positionReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := pr.f.Seek(offset, whence)
+	if err == nil {
+		pr.pos = pos
+	}
+	return pos, err
+}
+
+//
+// end of file
+//
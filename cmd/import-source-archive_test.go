@@ -0,0 +1,221 @@
+//
+// tests for the archive import source
+//
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// the objects built from an archive should be identical to those built from the directory
+func TestArchiveSourceGolden(t *testing.T) {
+
+	for _, archive := range []string{"export.tar", "export.tar.gz", "export.zip"} {
+		t.Run(archive, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), archive)
+			makeFixtureArchive(t, filename)
+
+			src, err := newImportSource(filename)
+			if err != nil {
+				t.Fatalf("opening archive (%s)", err.Error())
+			}
+			defer src.close()
+			inputSource = src
+			defer func() { inputSource = localSource{} }()
+
+			checkGoldenWorks(t, filename, false)
+		})
+	}
+}
+
+// the works in a compressed archive that is not in name order are read in archive order,
+// without going back to the beginning
+func TestArchiveSourceUnsorted(t *testing.T) {
+
+	filename := filepath.Join(t.TempDir(), "export.tar.gz")
+	entries := fixtureEntries(t)
+	slices.Reverse(entries)
+	writeArchive(t, filename, entries)
+
+	src, err := newArchiveSource(filename)
+	if err != nil {
+		t.Fatalf("opening archive (%s)", err.Error())
+	}
+	defer src.close()
+	inputSource = src
+	defer func() { inputSource = localSource{} }()
+
+	checkGoldenWorks(t, filename, false)
+	if src.restarts == 0 {
+		t.Errorf("expected reading in name order to restart")
+	}
+
+	// a fresh source, read in archive order as the import does
+	src, err = newArchiveSource(filename)
+	if err != nil {
+		t.Fatalf("opening archive (%s)", err.Error())
+	}
+	defer src.close()
+	inputSource = src
+
+	items, err := src.readDir(filename)
+	if err != nil {
+		t.Fatalf("listing archive (%s)", err.Error())
+	}
+	dirs := make([]string, 0, len(items))
+	for _, e := range items {
+		dirs = append(dirs, path.Join(filename, e.name))
+	}
+	ordered := orderWorks(filename, dirs, "archive")
+	for ix, wo := range ordered {
+		if ix != 0 && wo.name > ordered[ix-1].name {
+			t.Errorf("expected reverse name order, got %s after %s", wo.name, ordered[ix-1].name)
+		}
+		summarizeWork(wo.dirname)
+		files, _ := src.readDir(wo.dirname)
+		for _, f := range files {
+			if _, err := src.readFile(path.Join(wo.dirname, f.name)); err != nil {
+				t.Errorf("%s: unexpected error (%s)", f.name, err.Error())
+			}
+		}
+	}
+	if src.restarts != 0 {
+		t.Errorf("expected to read the archive once, restarted %d time(s)", src.restarts)
+	}
+}
+
+// absolute names and names outside the archive
+func TestArchiveEntryNames(t *testing.T) {
+
+	filename := filepath.Join(t.TempDir(), "export.tar")
+	writeArchive(t, filename, []archiveFile{
+		{"/export/w1/work.json", []byte(`{"id": "w1"}`)},
+		{"./export/w1/fileset-1.json", []byte(`{"title": ["a.txt"]}`)},
+		{"//export/w1/a.txt", []byte("a")},
+		{"../outside.txt", []byte("x")},
+		{"export/../../outside.txt", []byte("x")},
+	})
+
+	src, err := newArchiveSource(filename)
+	if err != nil {
+		t.Fatalf("opening archive (%s)", err.Error())
+	}
+	defer src.close()
+
+	for _, name := range []string{"w1", "w1/work.json", "w1/fileset-1.json", "w1/a.txt"} {
+		if src.exists(path.Join(filename, name)) == false {
+			t.Errorf("expected %s to exist", name)
+		}
+	}
+	if len(src.files) != 3 {
+		t.Errorf("expected 3 files, got %d", len(src.files))
+	}
+}
+
+// an archive member
+type archiveFile struct {
+	name string
+	buf  []byte
+}
+
+// the fixtures, wrapped in a top level directory like a real export
+func fixtureEntries(t *testing.T) []archiveFile {
+	entries := make([]archiveFile, 0)
+	err := filepath.Walk(fixtureDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() == true {
+			return err
+		}
+		rel, _ := filepath.Rel(fixtureDir, p)
+		buf, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, archiveFile{name: filepath.ToSlash(filepath.Join("export", rel)), buf: buf})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("reading fixtures (%s)", err.Error())
+	}
+	return entries
+}
+
+// archive the fixtures
+func makeFixtureArchive(t *testing.T, filename string) {
+	writeArchive(t, filename, fixtureEntries(t))
+}
+
+// write the entries to an archive of the type given by the filename
+func writeArchive(t *testing.T, filename string, entries []archiveFile) {
+
+	out, err := os.Create(filename)
+	if err != nil {
+		t.Fatalf("creating archive (%s)", err.Error())
+	}
+	defer out.Close()
+
+	var add func(name string, buf []byte) error
+	var finish func() error
+	switch archiveKind(filename) {
+	case archiveZip:
+		zw := zip.NewWriter(out)
+		add = func(name string, buf []byte) error {
+			w, err := zw.Create(name)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(buf)
+			return err
+		}
+		finish = zw.Close
+	default:
+		var w io.Writer = out
+		var gz *gzip.Writer
+		if archiveKind(filename) == archiveTgz {
+			gz = gzip.NewWriter(out)
+			w = gz
+		}
+		tw := tar.NewWriter(w)
+		add = func(name string, buf []byte) error {
+			err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(buf)), Typeflag: tar.TypeReg})
+			if err != nil {
+				return err
+			}
+			_, err = tw.Write(buf)
+			return err
+		}
+		finish = func() error {
+			if err := tw.Close(); err != nil {
+				return err
+			}
+			if gz != nil {
+				return gz.Close()
+			}
+			return nil
+		}
+	}
+
+	for _, e := range entries {
+		if err = add(e.name, e.buf); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = finish()
+	}
+	if err != nil {
+		t.Fatalf("writing archive (%s)", err.Error())
+	}
+}
+
+//
+// end of file
+//
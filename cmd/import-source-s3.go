@@ -0,0 +1,185 @@
+//
+// S3 import source, reads works from a bucket prefix (s3://bucket/prefix)
+//
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+var s3Scheme = "s3://"
+
+type s3Source struct {
+	location string     // s3://bucket/prefix, our root
+	bucket   string     // the bucket name
+	prefix   string     // the key prefix (no trailing slash)
+	client   *s3.Client // the S3 client
+}
+
+func isS3Location(location string) bool {
+	return strings.HasPrefix(location, s3Scheme)
+}
+
+// create a new S3 source. Credentials and region come from the usual AWS environment, set
+// S3ENDPOINT to use an S3 compatible service instead of AWS
+func newS3Source(location string) (*s3Source, error) {
+
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(location, s3Scheme), "/")
+	if len(bucket) == 0 {
+		return nil, fmt.Errorf("bad S3 location (%s), must be s3://bucket/prefix", location)
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := os.Getenv("S3ENDPOINT")
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if len(endpoint) != 0 {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+			// compatible services do not always return checksums
+			o.DisableLogOutputChecksumValidationSkipped = true
+		}
+	})
+
+	impl := &s3Source{
+		location: location,
+		bucket:   bucket,
+		prefix:   strings.Trim(prefix, "/"),
+		client:   client,
+	}
+
+	// make sure there is something there
+	if impl.exists(location) == false {
+		return nil, &fs.PathError{Op: "open", Path: location, Err: fs.ErrNotExist}
+	}
+	return impl, nil
+}
+
+func (impl *s3Source) readDir(dirname string) ([]sourceEntry, error) {
+
+	prefix := impl.key(dirname)
+	if len(prefix) != 0 {
+		prefix = fmt.Sprintf("%s/", prefix)
+	}
+
+	entries := make([]sourceEntry, 0)
+	paginator := s3.NewListObjectsV2Paginator(impl.client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(impl.bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+	for paginator.HasMorePages() == true {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		for _, cp := range page.CommonPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(aws.ToString(cp.Prefix), prefix), "/")
+			entries = append(entries, sourceEntry{name: name, isDir: true})
+		}
+		for _, obj := range page.Contents {
+			name := strings.TrimPrefix(aws.ToString(obj.Key), prefix)
+			// some tools create placeholder objects for directories
+			if len(name) == 0 {
+				continue
+			}
+			entries = append(entries, sourceEntry{name: name, size: aws.ToInt64(obj.Size)})
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, &fs.PathError{Op: "readdir", Path: dirname, Err: fs.ErrNotExist}
+	}
+	return entries, nil
+}
+
+func (impl *s3Source) readFile(filename string) ([]byte, error) {
+	r, err := impl.open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func (impl *s3Source) open(filename string) (io.ReadCloser, error) {
+	out, err := impl.client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(impl.bucket),
+		Key:    aws.String(impl.key(filename)),
+	})
+	if err != nil {
+		if s3NotFound(err) == true {
+			return nil, &fs.PathError{Op: "open", Path: filename, Err: fs.ErrNotExist}
+		}
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (impl *s3Source) exists(filename string) bool {
+
+	key := impl.key(filename)
+	if len(key) != 0 {
+		_, err := impl.client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+			Bucket: aws.String(impl.bucket),
+			Key:    aws.String(key),
+		})
+		if err == nil {
+			return true
+		}
+		if s3NotFound(err) == false {
+			logError(fmt.Sprintf("checking s3://%s/%s (%s)", impl.bucket, key, err.Error()))
+			return false
+		}
+		key = fmt.Sprintf("%s/", key)
+	}
+
+	// it might be a directory
+	out, err := impl.client.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
+		Bucket:  aws.String(impl.bucket),
+		Prefix:  aws.String(key),
+		MaxKeys: aws.Int32(1),
+	})
+	if err != nil {
+		logError(fmt.Sprintf("listing s3://%s/%s (%s)", impl.bucket, key, err.Error()))
+		return false
+	}
+	return len(out.Contents) != 0
+}
+
+func (impl *s3Source) close() error {
+	return nil
+}
+
+// convert the source path into the object key
+func (impl *s3Source) key(filename string) string {
+	return strings.TrimPrefix(path.Join(impl.prefix, relativePath(impl.location, filename)), "/")
+}
+
+func s3NotFound(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) == true {
+		code := apiErr.ErrorCode()
+		return code == "NoSuchKey" || code == "NotFound" || code == "NoSuchBucket"
+	}
+	return false
+}
+
+//
+// end of file
+//
@@ -0,0 +1,156 @@
+//
+// tests for the S3 import source, run against a minimal S3 compatible stand-in
+//
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// serves the fixtures from bucket "exports" with the key prefix "staging/export"
+type fakeS3 struct {
+	objects map[string][]byte // key -> contents
+}
+
+type fakeS3Contents struct {
+	Key  string `xml:"Key"`
+	Size int64  `xml:"Size"`
+}
+
+type fakeS3Prefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type fakeS3List struct {
+	XMLName        xml.Name         `xml:"ListBucketResult"`
+	Name           string           `xml:"Name"`
+	Prefix         string           `xml:"Prefix"`
+	KeyCount       int              `xml:"KeyCount"`
+	IsTruncated    bool             `xml:"IsTruncated"`
+	Contents       []fakeS3Contents `xml:"Contents"`
+	CommonPrefixes []fakeS3Prefix   `xml:"CommonPrefixes"`
+}
+
+func newFakeS3(t *testing.T) *httptest.Server {
+
+	fake := &fakeS3{objects: make(map[string][]byte)}
+	err := filepath.Walk(fixtureDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() == true {
+			return err
+		}
+		rel, _ := filepath.Rel(fixtureDir, p)
+		buf, err := os.ReadFile(p)
+		fake.objects[fmt.Sprintf("staging/export/%s", filepath.ToSlash(rel))] = buf
+		return err
+	})
+	if err != nil {
+		t.Fatalf("loading fixtures (%s)", err.Error())
+	}
+	return httptest.NewServer(fake)
+}
+
+func (fake *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != "exports" {
+		fake.error(w, r, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	// list objects
+	if len(key) == 0 {
+		fake.list(w, r.URL.Query().Get("prefix"), r.URL.Query().Get("delimiter"))
+		return
+	}
+
+	buf, found := fake.objects[key]
+	if found == false {
+		fake.error(w, r, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(buf)))
+	if r.Method == http.MethodGet {
+		w.Write(buf)
+	}
+}
+
+func (fake *fakeS3) list(w http.ResponseWriter, prefix string, delimiter string) {
+
+	result := fakeS3List{Name: "exports", Prefix: prefix}
+	prefixes := make(map[string]bool)
+	keys := make([]string, 0)
+	for k := range fake.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if strings.HasPrefix(k, prefix) == false {
+			continue
+		}
+		rest := strings.TrimPrefix(k, prefix)
+		if len(delimiter) != 0 && strings.Contains(rest, delimiter) == true {
+			cp := prefix + rest[:strings.Index(rest, delimiter)+1]
+			if prefixes[cp] == false {
+				prefixes[cp] = true
+				result.CommonPrefixes = append(result.CommonPrefixes, fakeS3Prefix{Prefix: cp})
+			}
+			continue
+		}
+		result.Contents = append(result.Contents, fakeS3Contents{Key: k, Size: int64(len(fake.objects[k]))})
+	}
+	result.KeyCount = len(result.Contents) + len(result.CommonPrefixes)
+
+	w.Header().Set("Content-Type", "application/xml")
+	buf, _ := xml.Marshal(result)
+	w.Write(buf)
+}
+
+func (fake *fakeS3) error(w http.ResponseWriter, r *http.Request, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+	}
+}
+
+// the objects built from S3 should be identical to those built from the directory
+func TestS3SourceGolden(t *testing.T) {
+
+	server := newFakeS3(t)
+	defer server.Close()
+
+	t.Setenv("S3ENDPOINT", server.URL)
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+	location := "s3://exports/staging/export"
+	src, err := newImportSource(location)
+	if err != nil {
+		t.Fatalf("opening source (%s)", err.Error())
+	}
+	defer src.close()
+	inputSource = src
+	defer func() { inputSource = localSource{} }()
+
+	checkGoldenWorks(t, location, false)
+
+	_, err = newImportSource("s3://exports/not/there")
+	if err == nil {
+		t.Fatalf("expected an error for a missing prefix")
+	}
+}
+
+//
+// end of file
+//
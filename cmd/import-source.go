@@ -0,0 +1,120 @@
+//
+// import sources, where the exported works are read from
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// an import source provides access to the export directory tree. Paths are always
+// of the form <root>/<relative path> where root is the location the source was created with
+type importSource interface {
+	readDir(dirname string) ([]sourceEntry, error) // list the directory contents
+	readFile(filename string) ([]byte, error)      // read the entire file
+	open(filename string) (io.ReadCloser, error)   // stream the file
+	exists(filename string) bool                   // does the file (or directory) exist
+	close() error                                  // release any resources
+}
+
+// a source that knows the content hash of its files without reading them again
+type hashingSource interface {
+	fileHash(filename string) (string, bool) // the SHA256 of the file contents, if known
+}
+
+// a source that can only be read sequentially, works are best read in the order they
+// appear in the source
+type sequentialSource interface {
+	sequential() bool            // must the source be read sequentially
+	dirOrder(dirname string) int // the order of the directory within the source, -1 if unknown
+}
+
+// a directory entry
+type sourceEntry struct {
+	name  string // entry name (not the full path)
+	isDir bool   // is this a directory
+	size  int64  // file size
+}
+
+// where we read works from, the local filesystem unless configured otherwise
+var inputSource importSource = localSource{}
+
+// create the appropriate import source for the location
+func newImportSource(location string) (importSource, error) {
+
+	if isS3Location(location) == true {
+		return newS3Source(location)
+	}
+
+	if isArchive(location) == true {
+		return newArchiveSource(location)
+	}
+
+	fi, err := os.Stat(location)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() == false {
+		return nil, fmt.Errorf("%s is not a directory or a supported archive", location)
+	}
+	return localSource{}, nil
+}
+
+//
+// local filesystem source
+//
+
+type localSource struct{}
+
+func (impl localSource) readDir(dirname string) ([]sourceEntry, error) {
+	items, err := os.ReadDir(dirname)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]sourceEntry, 0, len(items))
+	for _, i := range items {
+		var size int64
+		if i.IsDir() == false {
+			fi, err := i.Info()
+			if err == nil {
+				size = fi.Size()
+			}
+		}
+		entries = append(entries, sourceEntry{name: i.Name(), isDir: i.IsDir(), size: size})
+	}
+	return entries, nil
+}
+
+func (impl localSource) readFile(filename string) ([]byte, error) {
+	return os.ReadFile(filename)
+}
+
+func (impl localSource) open(filename string) (io.ReadCloser, error) {
+	return os.Open(filename)
+}
+
+func (impl localSource) exists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil || errors.Is(err, os.ErrNotExist) == false
+}
+
+func (impl localSource) close() error {
+	return nil
+}
+
+// remove the root from the path, returns the relative path
+func relativePath(root string, filename string) string {
+	if filename == root {
+		return ""
+	}
+	return strings.TrimPrefix(filename, fmt.Sprintf("%s/", root))
+}
+
+//
+// end of file
+//
@@ -0,0 +1,64 @@
+//
+// locate the work directories within an export, works may be nested at any depth
+// (export/2019/<id>/work.json)
+//
+
+package main
+
+import (
+	"fmt"
+)
+
+// find the work directories below root. A work directory is one containing a work.json file,
+// we do not look below a work directory. Directories that have no works anywhere below them
+// are reported as strays (only the topmost one of any stray tree is reported).
+func findWorks(root string) ([]string, []string, error) {
+	works := make([]string, 0)
+	strays := make([]string, 0)
+	_, err := walkWorks(root, &works, &strays)
+	return works, strays, err
+}
+
+// walk the directory, returns the number of works found at or below it
+func walkWorks(dirname string, works *[]string, strays *[]string) (int, error) {
+
+	entries, err := inputSource.readDir(dirname)
+	if err != nil {
+		return 0, err
+	}
+
+	// is this a work
+	for _, e := range entries {
+		if e.isDir == false && e.name == "work.json" {
+			*works = append(*works, dirname)
+			return 1, nil
+		}
+	}
+
+	found := 0
+	childStrays := make([]string, 0)
+	for _, e := range entries {
+		if e.isDir == false {
+			continue
+		}
+		child := fmt.Sprintf("%s/%s", dirname, e.name)
+		count, err := walkWorks(child, works, &childStrays)
+		if err != nil {
+			return 0, err
+		}
+		if count == 0 {
+			childStrays = append(childStrays, child)
+		}
+		found += count
+	}
+
+	// if nothing below us is a work, our parent will report us rather than our children
+	if found != 0 {
+		*strays = append(*strays, childStrays...)
+	}
+	return found, nil
+}
+
+//
+// end of file
+//
@@ -0,0 +1,62 @@
+//
+// tests for the work directory walker
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFindWorksNested(t *testing.T) {
+
+	root := t.TempDir()
+	layout := []string{
+		"2019/work1/work.json",
+		"2019/work1/nested/work.json", // below a work, ignored
+		"2019/work2/work.json",
+		"2020/batch-a/work3/work.json",
+		"2020/batch-a/notes.txt",
+		"2020/empty/readme.txt",
+		"stray/deeper/file.txt",
+		"work4/work.json",
+	}
+	for _, f := range layout {
+		name := filepath.Join(root, f)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatalf("creating layout (%s)", err.Error())
+		}
+		if err := os.WriteFile(name, []byte("{}"), 0644); err != nil {
+			t.Fatalf("creating layout (%s)", err.Error())
+		}
+	}
+
+	works, strays, err := findWorks(root)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+
+	expectedWorks := []string{"2019/work1", "2019/work2", "2020/batch-a/work3", "work4"}
+	expectedStrays := []string{"2020/empty", "stray"}
+	for ix, e := range expectedWorks {
+		expectedWorks[ix] = fmt.Sprintf("%s/%s", root, e)
+	}
+	for ix, e := range expectedStrays {
+		expectedStrays[ix] = fmt.Sprintf("%s/%s", root, e)
+	}
+
+	if slices.Equal(works, expectedWorks) == false {
+		t.Errorf("works: expected %v, got %v", expectedWorks, works)
+	}
+	if slices.Equal(strays, expectedStrays) == false {
+		t.Errorf("strays: expected %v, got %v", expectedStrays, strays)
+	}
+}
+
+//
+// end of file
+//
@@ -0,0 +1,158 @@
+//
+// the import loop, builds the objects for the work directories and creates them in batches
+//
+
+package main
+
+import (
+	"fmt"
+	"github.com/uvalib/easystore/uvaeasystore"
+)
+
+type workImporter struct {
+	es           uvaeasystore.EasyStore
+	namespace    string
+	opts         importOptions
+	duplicates   string          // duplicate work handling (none|report|skip|merge|fail)
+	dups         *duplicateIndex // the duplicate works, nil if we do not look for them
+	excludeFiles bool            // do not import files
+	dryRun       bool            // build the objects but do not create them
+	limit        int             // the most objects to import, 0 for no limit
+	batchSize    int             // objects created together
+	events       *eventPublisher // nil if we do not publish events
+	report       *runReport
+
+	okCount    int
+	errCount   int
+	skipCount  int
+	createdIds []string
+
+	dirs    []string               // the works to import, promoted duplicates are added at the end
+	works   map[string]*workReport // the report for each work we have seen
+	pending []pendingWork          // the batch waiting to be created
+}
+
+// import the works in order, a duplicate that takes the place of a work that failed is
+// imported even if we have already skipped it
+func (wi *workImporter) run(dirs []string) {
+
+	wi.dirs = append([]string{}, dirs...)
+	wi.works = make(map[string]*workReport)
+	wi.createdIds = make([]string, 0)
+	wi.pending = make([]pendingWork, 0, wi.batchSize)
+
+	for start := 0; start < len(wi.dirs); {
+		end := len(wi.dirs)
+		for ix := start; ix < end; ix++ {
+
+			// if we are limiting our import count
+			if wi.limit != 0 && ((wi.okCount + wi.errCount + len(wi.pending)) >= wi.limit) {
+				logDebug(fmt.Sprintf("terminating after %d object(s)", wi.limit))
+				break
+			}
+			wi.importWork(ix)
+		}
+		start = end
+
+		// a failed create may promote a duplicate we have already seen
+		if len(wi.pending) != 0 {
+			wi.flush()
+		}
+	}
+}
+
+// build the object for the work and add it to the pending batch
+func (wi *workImporter) importWork(ix int) {
+
+	dirname := wi.dirs[ix]
+	wr, found := wi.works[dirname]
+	if found == false {
+		wr = wi.report.newWork(dirname)
+		wi.works[dirname] = wr
+	}
+
+	// duplicates are skipped (or merged into their primary work)
+	if (wi.duplicates == "skip" || wi.duplicates == "merge") && wi.dups.isDuplicate(dirname) == true {
+		logInfo(fmt.Sprintf("skipping duplicate work %s (%d of %d)", dirname, ix+1, len(wi.dirs)))
+		wr.Status = workSkipped
+		wr.Reason = "duplicate work"
+		wi.skipCount++
+		return
+	}
+
+	logInfo(fmt.Sprintf("importing from %s (%d of %d)", dirname, ix+1, len(wi.dirs)))
+
+	obj, err := makeEtdObject(wi.namespace, dirname, wi.opts, wr)
+	if err != nil {
+		logError(fmt.Sprintf("creating object (%s), continuing", err.Error()))
+		wi.failed(dirname, wr, err)
+		return
+	}
+
+	if wi.duplicates == "merge" && wi.excludeFiles == false {
+		err = wi.dups.mergeDuplicates(obj, dirname, wi.opts, wr)
+		if err != nil {
+			logError(fmt.Sprintf("merging duplicates for [%s] (%s), continuing", obj.Id(), err.Error()))
+			wi.failed(dirname, wr, err)
+			return
+		}
+	}
+
+	// if we are configured to import
+	if wi.dryRun == false {
+		wi.pending = append(wi.pending, pendingWork{dirname: dirname, obj: obj, wr: wr})
+		if len(wi.pending) >= wi.batchSize {
+			wi.flush()
+		}
+		return
+	}
+
+	wr.Status = workProcessed
+	wi.okCount++
+}
+
+// create the pending batch of objects and record the outcomes
+func (wi *workImporter) flush() {
+	for _, o := range createBatch(wi.es, wi.pending) {
+		if o.err != nil {
+			logError(fmt.Sprintf("importing ns/oid [%s/%s] (%s), continuing", o.obj.Namespace(), o.obj.Id(), o.err.Error()))
+			if o.remains == true {
+				wi.report.Remaining = append(wi.report.Remaining, o.obj.Id())
+			}
+			wi.failed(o.dirname, o.wr, o.err)
+			continue
+		}
+		o.wr.Status = workImported
+		wi.events.workImported(o.created, o.dirname)
+		wi.createdIds = append(wi.createdIds, o.created.Id())
+		wi.okCount++
+	}
+	wi.pending = wi.pending[:0]
+}
+
+// the work did not make it into the store, a skipped or merged duplicate takes its place
+func (wi *workImporter) failed(dirname string, wr *workReport, err error) {
+	wr.failed(err)
+	wi.errCount++
+
+	if wi.duplicates != "skip" && wi.duplicates != "merge" {
+		return
+	}
+	primary := wi.dups.promote(dirname)
+	if len(primary) == 0 {
+		return
+	}
+	logWarning(fmt.Sprintf("duplicate work %s replaces %s", primary, dirname))
+
+	// we have already skipped it, import it after all
+	if pwr, seen := wi.works[primary]; seen == true {
+		pwr.Status = ""
+		pwr.Reason = ""
+		wi.skipCount--
+		wi.dirs = append(wi.dirs, primary)
+	}
+}
+
+//
+// end of file
+//
@@ -0,0 +1,84 @@
+//
+// tests for the import loop
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/uvalib/easystore/uvaeasystore"
+	"testing"
+)
+
+// a store that refuses to create one of the objects
+type failingCreateStore struct {
+	uvaeasystore.EasyStore
+	failId string
+}
+
+func (s failingCreateStore) ObjectCreate(obj uvaeasystore.EasyStoreObject) (uvaeasystore.EasyStoreObject, error) {
+	if obj.Id() == s.failId {
+		return nil, fmt.Errorf("create failed")
+	}
+	return s.EasyStore.ObjectCreate(obj)
+}
+
+// a duplicate takes the place of a primary that cannot be created, even when we skipped it
+// before the batch was created
+func TestImportPromotesDuplicate(t *testing.T) {
+
+	for _, test := range []struct {
+		duplicates string
+		batchSize  int
+	}{
+		{"skip", 10},
+		{"skip", 1},
+		{"merge", 10},
+		{"merge", 1},
+	} {
+		name := fmt.Sprintf("%s/%d", test.duplicates, test.batchSize)
+		root := t.TempDir()
+		a := makeDuplicateWork(t, root, "a", "work-a", "Common Title", "one")
+		b := makeDuplicateWork(t, root, "b", "work-b", "Common Title", "two")
+		c := makeDuplicateWork(t, root, "c", "work-c", "Common Title", "three")
+		dirs := []string{a, b, c}
+
+		mem := newMemoryEasyStore()
+		opts := goldenOptions()
+		opts.run.root = root
+		wi := &workImporter{es: failingCreateStore{EasyStore: mem, failId: "work-a"}, namespace: goldenNamespace, opts: opts,
+			duplicates: test.duplicates, dups: indexDuplicates(dirs), batchSize: test.batchSize, report: newRunReport(false, goldenAsOf)}
+		wi.run(dirs)
+
+		if wi.okCount != 1 || wi.errCount != 1 || wi.skipCount != 1 {
+			t.Errorf("%s: expected 1 imported, 1 error and 1 skipped, got %d, %d and %d", name, wi.okCount, wi.errCount, wi.skipCount)
+		}
+		if len(wi.report.Works) != len(dirs) {
+			t.Errorf("%s: expected one report per work, got %d", name, len(wi.report.Works))
+		}
+		if wi.works[a].Status != workError || wi.works[b].Status != workImported || wi.works[c].Status != workSkipped {
+			t.Errorf("%s: unexpected status %s, %s and %s", name, wi.works[a].Status, wi.works[b].Status, wi.works[c].Status)
+		}
+
+		// the promoted duplicate carries the files of the remaining duplicate when merging
+		obj, err := mem.ObjectGetByKey(goldenNamespace, "work-b", uvaeasystore.Files)
+		if err != nil {
+			t.Fatalf("%s: expected the duplicate to be imported (%s)", name, err.Error())
+		}
+		files := 1
+		if test.duplicates == "merge" {
+			files = 2
+		}
+		if len(obj.Files()) != files {
+			t.Errorf("%s: expected %d file(s), got %d", name, files, len(obj.Files()))
+		}
+		if _, err = mem.ObjectGetByKey(goldenNamespace, "work-c", uvaeasystore.BaseComponent); errors.Is(err, uvaeasystore.ErrNotFound) == false {
+			t.Errorf("%s: expected the other duplicate to be skipped, got %v", name, err)
+		}
+	}
+}
+
+//
+// end of file
+//
@@ -0,0 +1,118 @@
+//
+// language normalization, exports use names, two and three letter codes and lists of them
+// for the same thing so the values are mapped through a bundled table
+//
+
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// the language output formats, none keeps the export value
+var languageFormats = []string{"label", "code", "none"}
+
+// the bundled language table: ISO 639-2 (bibliographic) code, the terminology code when it
+// differs, ISO 639-1 code, label and any other names (name|name)
+//
+//go:embed data/languages.csv
+var languageTableCsv []byte
+
+// separates the languages when there are several
+var languageSeparatorRe = regexp.MustCompile(`\s*(?:[;,/|]|\band\b|&)\s*`)
+
+// multiple languages are joined with this
+var languageJoin = "; "
+
+type language struct {
+	code  string // ISO 639-2 code
+	label string // controlled label
+}
+
+type languageTable struct {
+	lookup map[string]language // lower case code or name -> language
+}
+
+func loadLanguageTable(buf []byte) (*languageTable, error) {
+
+	r := csv.NewReader(bytes.NewReader(buf))
+	r.FieldsPerRecord = 5
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading language table (%s)", err.Error())
+	}
+
+	t := &languageTable{lookup: make(map[string]language)}
+	for ix, rec := range records {
+		// skip the header
+		if ix == 0 {
+			continue
+		}
+		lang := language{code: strings.TrimSpace(rec[0]), label: strings.TrimSpace(rec[3])}
+		if len(lang.code) == 0 || len(lang.label) == 0 {
+			return nil, fmt.Errorf("language table line %d is missing the code or label", ix+1)
+		}
+		keys := append([]string{rec[0], rec[1], rec[2], rec[3]}, strings.Split(rec[4], "|")...)
+		for _, k := range keys {
+			k = strings.ToLower(strings.TrimSpace(k))
+			if len(k) != 0 {
+				t.lookup[k] = lang
+			}
+		}
+	}
+	return t, nil
+}
+
+// load the bundled language table
+func newLanguageTable() (*languageTable, error) {
+	return loadLanguageTable(languageTableCsv)
+}
+
+// normalize the language value to the specified format, returns the normalized value and the
+// values we could not map (they are kept as they are). A nil table leaves the value alone
+func (t *languageTable) normalize(value string, format string) (string, []string) {
+
+	if t == nil || format == "none" || len(format) == 0 || len(strings.TrimSpace(value)) == 0 {
+		return value, nil
+	}
+
+	// the whole value first, some names contain separators
+	parts := []string{value}
+	if _, found := t.lookup[strings.ToLower(strings.TrimSpace(value))]; found == false {
+		parts = languageSeparatorRe.Split(value, -1)
+	}
+
+	result := make([]string, 0, len(parts))
+	unmapped := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if len(p) == 0 {
+			continue
+		}
+		mapped := p
+		lang, found := t.lookup[strings.ToLower(p)]
+		if found == true {
+			mapped = lang.label
+			if format == "code" {
+				mapped = lang.code
+			}
+		} else {
+			unmapped = append(unmapped, p)
+		}
+		if seen[mapped] == false {
+			seen[mapped] = true
+			result = append(result, mapped)
+		}
+	}
+	return strings.Join(result, languageJoin), unmapped
+}
+
+//
+// end of file
+//
@@ -0,0 +1,67 @@
+//
+// tests for the language normalization
+//
+
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// the bundled language table, the table is part of the build so an error is a programming error
+func defaultLanguageTable() *languageTable {
+	t, err := newLanguageTable()
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestNormalizeLanguage(t *testing.T) {
+
+	tests := []struct {
+		value    string
+		format   string
+		expected string
+		unmapped []string
+	}{
+		{"English", "label", "English", nil},
+		{"eng", "label", "English", nil},
+		{"en", "label", "English", nil},
+		{" ENGLISH ", "code", "eng", nil},
+		{"English; French", "label", "English; French", nil},
+		{"English; fre", "code", "eng; fre", nil},
+		{"deu, ger and Deutsch", "label", "German", nil},
+		{"Spanish/Klingon", "label", "Spanish; Klingon", []string{"Klingon"}},
+		{"Mandarin Chinese", "code", "chi", nil},
+		{"eng; fre", "none", "eng; fre", nil},
+		{"", "label", "", nil},
+	}
+
+	for _, test := range tests {
+		got, unmapped := defaultLanguageTable().normalize(test.value, test.format)
+		if got != test.expected || slices.Equal(unmapped, test.unmapped) == false {
+			t.Errorf("normalize(%q, %s) = %q %v, expected %q %v", test.value, test.format, got, unmapped, test.expected, test.unmapped)
+		}
+	}
+
+	// no table, no mapping
+	var none *languageTable
+	if got, unmapped := none.normalize("eng", "label"); got != "eng" || len(unmapped) != 0 {
+		t.Errorf("expected the value unchanged without a table, got %q %v", got, unmapped)
+	}
+}
+
+func TestLoadLanguageTable(t *testing.T) {
+	if _, err := loadLanguageTable([]byte("code,alternate,alpha2,label,aliases\n,,,English,\n")); err == nil {
+		t.Errorf("expected an error for a missing code")
+	}
+	if _, err := loadLanguageTable([]byte("code,label\neng,English\n")); err == nil {
+		t.Errorf("expected an error for missing columns")
+	}
+}
+
+//
+// end of file
+//
@@ -6,12 +6,18 @@ import (
 	"github.com/uvalib/easystore/uvaeasystore"
 	"log"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // global logging level
 var logLevel string
 
+// the commands we support, import unless specified
+var commands = []string{"import", "diff", "inspect"}
+
 // main entry point
 func main() {
 
@@ -22,17 +28,84 @@ func main() {
 	var excludeFiles bool
 	var dryRun bool
 	var limit int
+	var batchSize int
+	var objectRate float64
+	var maxBytesRate int
+	var duplicates string
+	var embargoExpired string
+	var embargoMaxYears int
+	var embargoVisMap string
+	var reportFile string
+	var asOf string
+	var shardSpec string
+	var publish string
+	var eventFile string
+	var storeEvents string
+	var manifestFile string
+	var diffFormat string
+	var sortBy string
+	var failOn string
+	var cleanupStages string
+	var htmlAllow string
+	var languageFormat string
+	var vocabularyFile string
+	var badUrls string
+	var runId string
+	var libraBaseUrl string
+	var privateFiles string
 	var logger *log.Logger
 
-	flag.StringVar(&mode, "mode", "postgres", "Mode, sqlite, postgres, s3")
+	flag.StringVar(&mode, "mode", "postgres", "Mode, sqlite, postgres, s3, proxy, memory")
 	flag.StringVar(&namespace, "namespace", "", "Namespace to import")
-	flag.StringVar(&inDir, "importdir", "", "Import directory")
+	flag.StringVar(&inDir, "importdir", "", "Import directory or archive (.tar, .tar.gz, .zip)")
 	flag.BoolVar(&debug, "debug", false, "Log debug information")
 	flag.BoolVar(&excludeFiles, "nofiles", false, "Do not import files")
 	flag.BoolVar(&dryRun, "dryrun", false, "Process but do not actually import")
 	flag.IntVar(&limit, "limit", 0, "Number of items to import, 0 for no limit")
+	flag.Float64Var(&objectRate, "rate", 0, "Maximum objects created per second, 0 for no limit (we still slow down when the service asks)")
+	flag.IntVar(&maxBytesRate, "maxbytesrate", 0, "Maximum bytes per second to the service (proxy mode), 0 for no limit")
+	flag.IntVar(&batchSize, "batchsize", 1, "Number of objects created together, best effort and not atomic: if any fail the others in the batch are deleted again")
 	flag.StringVar(&logLevel, "loglevel", "E", "Logging level (D|I|W|E)")
-	flag.Parse()
+	flag.StringVar(&duplicates, "duplicates", "none", "Duplicate work handling (none|report|skip|merge|fail)")
+	flag.StringVar(&embargoExpired, "embargoexpired", "keep", "Expired embargo handling (keep|release|drop)")
+	flag.IntVar(&embargoMaxYears, "embargomax", 0, "Maximum embargo length in years, 0 for no limit")
+	flag.StringVar(&embargoVisMap, "embargovis", "authenticated=uva", "Visibility vocabulary mapping (from=to,from=to)")
+	flag.StringVar(&reportFile, "report", "", "Write a run report (JSON) to this file")
+	flag.StringVar(&asOf, "asof", "", "Reference time for embargo decisions (YYYY-MM-DD or RFC3339), default now")
+	flag.StringVar(&shardSpec, "shard", "", "Import only shard i of n (i/n, 0 <= i < n), works are assigned by id")
+	flag.StringVar(&sortBy, "sort", "name", "Work ordering (name|date_created|size|archive), compressed tar archives are always read in archive order")
+	flag.StringVar(&publish, "publish", "none", "Publish import events (none|bus|file)")
+	flag.StringVar(&eventFile, "eventfile", "", "Event file (JSON lines) when publishing to a file")
+	flag.StringVar(&storeEvents, "storeevents", "on", "Store generated events (on|off|batch), batch publishes one event at the end through -publish. Must be on in proxy mode")
+	flag.StringVar(&manifestFile, "manifest", "", "Write the ids of the created objects to this file")
+	flag.StringVar(&failOn, "failon", "none", "Fail works with these metadata diagnostics (none or sev,sev where sev is missing-required|missing-optional|wrong-type)")
+	flag.StringVar(&cleanupStages, "cleanup", defaultCleanupStages, "Text cleanup stages (none or stage,stage where stage is mojibake|html|entities|nfc|whitespace|keywords)")
+	flag.StringVar(&htmlAllow, "htmlallow", "", "HTML tags kept by the html cleanup stage (tag,tag), the others are stripped")
+	flag.StringVar(&languageFormat, "language", "label", "Language format (label|code|none), none keeps the export value")
+	flag.StringVar(&vocabularyFile, "vocabulary", "", "Program and degree mapping file (field,kind,match,value) tried before the bundled mapping, none to disable mapping")
+	flag.StringVar(&badUrls, "badurls", "flag", "Invalid related URL handling (flag|drop), flagged URLs are kept and reported")
+	flag.StringVar(&libraBaseUrl, "librabaseurl", "", "Base URL for legacy Libra links to works without a DOI, the work id is appended")
+	flag.StringVar(&privateFiles, "privatefiles", "skip", "Private file handling (skip|include|fail), a file is private when it is less visible than its work. File embargoes are recorded, not enforced")
+	flag.StringVar(&runId, "runid", "", "Import run identifier recorded with each work, generated if not specified (share it between shards)")
+	flag.StringVar(&diffFormat, "format", "text", "Diff and inspect output format (text|json)")
+
+	// the command is optional and comes before the flags
+	command := "import"
+	args := os.Args[1:]
+	if len(args) != 0 && slices.Contains(commands, args[0]) == true {
+		command = args[0]
+		args = args[1:]
+	}
+
+	// inspect takes the work directory as an argument, before or after the flags
+	if command == "inspect" && len(args) != 0 && strings.HasPrefix(args[0], "-") == false {
+		inDir = args[0]
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	if command == "inspect" && flag.NArg() != 0 {
+		inDir = flag.Arg(0)
+	}
 
 	if debug == true {
 		logger = log.Default()
@@ -43,17 +116,157 @@ func main() {
 		logError("must specify import dir")
 		os.Exit(1)
 	}
-	_, err := os.Stat(inDir)
+	inDir = strings.TrimSuffix(inDir, "/")
+	source, err := newImportSource(inDir)
 	if err != nil {
 		logError(fmt.Sprintf("import dir does not exist or is not readable (%s)", err.Error()))
 		os.Exit(1)
 	}
+	inputSource = source
+	defer inputSource.close()
 
 	if logLevel != "D" && logLevel != "I" && logLevel != "W" && logLevel != "E" {
 		logError("logging level must be D|I|W|E")
 		os.Exit(1)
 	}
 
+	if slices.Contains(duplicatePolicies, duplicates) == false {
+		logError("duplicates must be none|report|skip|merge|fail")
+		os.Exit(1)
+	}
+
+	if slices.Contains(sortPolicies, sortBy) == false {
+		logError("sort must be name|date_created|size|archive")
+		os.Exit(1)
+	}
+
+	// going backwards in a compressed archive means reading it again from the beginning
+	if ss, ok := inputSource.(sequentialSource); ok == true && ss.sequential() == true && sortBy != "archive" {
+		logWarning(fmt.Sprintf("%s can only be read sequentially, using archive order rather than %s", inDir, sortBy))
+		sortBy = "archive"
+	}
+
+	shard, err := parseShard(shardSpec)
+	if err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+
+	if slices.Contains(publishPolicies, publish) == false {
+		logError("publish must be none|bus|file")
+		os.Exit(1)
+	}
+
+	if slices.Contains(storeEventPolicies, storeEvents) == false {
+		logError("storeevents must be on|off|batch")
+		os.Exit(1)
+	}
+
+	// the store only publishes its own events when we let it, in proxy mode the service
+	// publishes them so they cannot be turned off
+	storeBusName := ""
+	if storeEvents == "on" {
+		storeBusName = os.Getenv("BUSNAME")
+	} else if mode == "proxy" {
+		logError("storeevents must be on in proxy mode, the service publishes the store events")
+		os.Exit(1)
+	}
+
+	// the batch event needs somewhere to go
+	if storeEvents == "batch" && publish == "none" {
+		logError("storeevents batch requires publish bus|file for the batch event")
+		os.Exit(1)
+	}
+
+	if slices.Contains(diffFormats, diffFormat) == false {
+		logError("format must be text|json")
+		os.Exit(1)
+	}
+
+	if batchSize < 1 {
+		logError("batchsize must be at least 1")
+		os.Exit(1)
+	}
+
+	if objectRate < 0 || maxBytesRate < 0 {
+		logError("rate and maxbytesrate cannot be negative")
+		os.Exit(1)
+	}
+	if maxBytesRate != 0 && mode != "proxy" {
+		logWarning("maxbytesrate only applies in proxy mode, ignoring")
+	}
+
+	if slices.Contains(languageFormats, languageFormat) == false {
+		logError("language must be label|code|none")
+		os.Exit(1)
+	}
+
+	if slices.Contains(privateFilePolicies, privateFiles) == false {
+		logError("privatefiles must be skip|include|fail")
+		os.Exit(1)
+	}
+
+	opts := importOptions{excludeFiles: excludeFiles, language: languageFormat, privateFiles: privateFiles, run: newImportRun(runId, inDir, time.Now())}
+	opts.asOf, err = parseAsOf(asOf)
+	if err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+	logAlways(fmt.Sprintf("import run %s (version %s)", opts.run.id, opts.run.version))
+	logAlways(fmt.Sprintf("time dependent decisions made as of %s", opts.asOf.Format(time.RFC3339)))
+
+	opts.embargo, err = newEmbargoPolicy(embargoExpired, embargoMaxYears, embargoVisMap)
+	if err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+
+	opts.diagnostics, err = newDiagnosticPolicy(failOn)
+	if err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+
+	opts.cleanup, err = newTextCleanup(cleanupStages, htmlAllow)
+	if err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+
+	if languageFormat != "none" {
+		opts.languages, err = newLanguageTable()
+		if err != nil {
+			logError(fmt.Sprintf("loading language table (%s)", err.Error()))
+			os.Exit(1)
+		}
+	}
+
+	if vocabularyFile != "none" {
+		opts.vocabulary, err = newVocabulary(vocabularyFile)
+		if err != nil {
+			logError(fmt.Sprintf("loading vocabulary (%s)", err.Error()))
+			os.Exit(1)
+		}
+	}
+
+	opts.related, err = newRelatedUrlPolicy(badUrls, libraBaseUrl)
+	if err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+
+	// show the object we would build, no backend required
+	if command == "inspect" {
+		err = inspectWork(namespace, inDir, opts, diffFormat, os.Stdout)
+		if err != nil {
+			logError(fmt.Sprintf("inspecting work (%s)", err.Error()))
+			os.Exit(1)
+		}
+		return
+	}
+
+	objectLimit := newRateLimiter(objectRate)
+
 	var implConfig uvaeasystore.EasyStoreImplConfig
 	var proxyConfig uvaeasystore.EasyStoreProxyConfig
 
@@ -92,19 +305,29 @@ func main() {
 			DbUser:              os.Getenv("DBUSER"),
 			DbPassword:          os.Getenv("DBPASS"),
 			DbTimeout:           asIntWithDefault(os.Getenv("DBTIMEOUT"), 0),
-			BusName:             os.Getenv("BUSNAME"),
+			BusName:             storeBusName,
 			SourceName:          os.Getenv("SOURCENAME"),
 			Log:                 logger,
 		}
 		es, err = uvaeasystore.NewEasyStore(implConfig)
 
 	case "proxy":
+		// all requests go through our throttling proxy
+		var endpoint string
+		endpoint, err = startThrottleProxy(os.Getenv("ESENDPOINT"), objectLimit, newRateLimiter(float64(maxBytesRate)))
+		if err != nil {
+			logError(fmt.Sprintf("starting throttling proxy (%s)", err.Error()))
+			os.Exit(1)
+		}
 		proxyConfig = uvaeasystore.ProxyConfigImpl{
-			ServiceEndpoint: os.Getenv("ESENDPOINT"),
+			ServiceEndpoint: endpoint,
 			Log:             logger,
 		}
 		es, err = uvaeasystore.NewEasyStoreProxy(proxyConfig)
 
+	case "memory":
+		es = newMemoryEasyStore()
+
 	default:
 		logError(fmt.Sprintf("unsupported mode (%s)", mode))
 		os.Exit(1)
@@ -118,11 +341,36 @@ func main() {
 	// important, cleanup properly
 	defer es.Close()
 
-	okCount := 0
-	errCount := 0
-	var obj uvaeasystore.EasyStoreObject
+	// the object rate is also slowed down when the service (proxy mode) is struggling
+	es = newThrottledEasyStore(es, objectLimit)
+
+	// show what an import would change rather than importing
+	if command == "diff" {
+		err = diffWorks(es, namespace, inDir, opts, diffFormat, os.Stdout)
+		if err != nil {
+			logError(fmt.Sprintf("diffing works (%s)", err.Error()))
+			os.Exit(1)
+		}
+		return
+	}
 
-	items, err := os.ReadDir(inDir)
+	// nothing is imported during a dry run so there is nothing to publish
+	var events *eventPublisher
+	if dryRun == false {
+		events, err = newEventPublisher(publish, eventFile, namespace)
+		if err != nil {
+			logError(fmt.Sprintf("creating event publisher (%s)", err.Error()))
+			os.Exit(1)
+		}
+		defer events.close()
+	}
+
+	report := newRunReport(dryRun, opts.asOf)
+	report.RunId = opts.run.id
+	report.Version = opts.run.version
+
+	// find the work directories, they may be nested
+	dirs, strays, err := findWorks(inDir)
 	if err != nil {
 		logError(err.Error())
 		os.Exit(1)
@@ -136,47 +384,93 @@ func main() {
 		logAlways("Dryrun, NO import!!")
 	}
 
-	// go through our list
-	total := len(items)
-	for ix, i := range items {
-		if i.IsDir() == true {
-
-			// if we are limiting our import count
-			if limit != 0 && ((okCount + errCount) >= limit) {
-				logDebug(fmt.Sprintf("terminating after %d object(s)", limit))
-				break
-			}
-
-			dirname := fmt.Sprintf("%s/%s", inDir, i.Name())
-			logInfo(fmt.Sprintf("importing from %s (%d of %d)", dirname, ix+1, total))
-
-			obj, err = makeEtdObject(namespace, dirname, excludeFiles)
+	// directories that do not contain works are reported and ignored
+	for _, stray := range strays {
+		logWarning(fmt.Sprintf("%s does not contain any works, ignoring", stray))
+		wr := report.newWork(stray)
+		wr.Status = workSkipped
+		wr.Reason = "not a work directory"
+	}
+	logAlways(fmt.Sprintf("found %d work(s) and %d stray director(ies)", len(dirs), len(strays)))
 
-			if err != nil {
-				logError(fmt.Sprintf("creating object (%s), continuing", err.Error()))
-				errCount++
-				continue
-			}
+	// legacy Libra links to works in the export are rewritten
+	opts.related.indexWorks(dirs)
 
-			// if we are configured to import
-			if dryRun == false {
-				_, err = es.ObjectCreate(obj)
-				if err != nil {
-					logError(fmt.Sprintf("importing ns/oid [%s/%s] (%s), continuing", obj.Namespace(), obj.Id(), err.Error()))
-					errCount++
-					continue
-				}
-			}
+	// order the works so limited and sharded runs are reproducible
+	ordered := orderWorks(inDir, dirs, sortBy)
+	dirs = make([]string, 0, len(ordered))
+	for _, wo := range ordered {
+		dirs = append(dirs, wo.dirname)
+	}
 
-			okCount++
+	// look for duplicate works before we import anything
+	var dups *duplicateIndex
+	if duplicates != "none" {
+		dups = indexDuplicates(dirs)
+		dups.report()
+		if duplicates == "fail" && dups.duplicateCount() != 0 {
+			logError(fmt.Sprintf("%d duplicate work(s) found, terminating", dups.duplicateCount()))
+			os.Exit(1)
 		}
 	}
 
+	// duplicates are identified across the entire export so all the shards agree
+	if shard.count != 0 {
+		dirs = shardWorks(ordered, shard)
+		logAlways(fmt.Sprintf("shard %s owns %d of %d work(s)", shard, len(dirs), len(ordered)))
+	}
+	report.Sort = sortBy
+	report.Shard = shard.String()
+
+	wi := &workImporter{es: es, namespace: namespace, opts: opts, duplicates: duplicates, dups: dups, excludeFiles: excludeFiles,
+		dryRun: dryRun, limit: limit, batchSize: batchSize, events: events, report: report}
+	wi.run(dirs)
+	okCount, skipCount, errCount := wi.okCount, wi.skipCount, wi.errCount
+
 	verb := "imported"
 	if dryRun == true {
 		verb = "processed"
 	}
-	logAlways(fmt.Sprintf("terminate normally, %s %d object(s) and %d error(s)", verb, okCount, errCount))
+	report.finish(okCount, skipCount, errCount)
+	if len(reportFile) != 0 {
+		err = report.write(reportFile)
+		if err != nil {
+			logError(fmt.Sprintf("writing report (%s)", err.Error()))
+		}
+	}
+
+	// record what we created
+	if len(manifestFile) != 0 && dryRun == false {
+		err = writeManifest(manifestFile, wi.createdIds)
+		if err != nil {
+			logError(fmt.Sprintf("writing manifest (%s)", err.Error()))
+			manifestFile = ""
+		}
+	}
+	if storeEvents == "batch" {
+		events.batchCreate(wi.createdIds, manifestFile)
+	}
+	events.runComplete(report, inDir)
+
+	if len(report.Remaining) != 0 {
+		logError(fmt.Sprintf("%d object(s) from failed batches could not be deleted and remain: %s", len(report.Remaining), strings.Join(report.Remaining, ", ")))
+	}
+	logAlways(fmt.Sprintf("metadata diagnostics: %s", summarizeDiagnostics(report.Diagnostics)))
+	logAlways(fmt.Sprintf("terminate normally, %s %d object(s), skipped %d duplicate(s) and %d error(s)", verb, okCount, skipCount, errCount))
+}
+
+// the reference time for time dependent decisions, now if not specified
+func parseAsOf(str string) (time.Time, error) {
+	if len(str) == 0 {
+		return time.Now().UTC(), nil
+	}
+	for _, format := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		tm, err := time.Parse(format, str)
+		if err == nil {
+			return tm.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad asof time (%s), must be YYYY-MM-DD or RFC3339", str)
 }
 
 func asIntWithDefault(str string, def int) int {
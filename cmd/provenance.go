@@ -0,0 +1,74 @@
+//
+// import provenance, every imported object records where it came from so it can be traced
+// back to the export it was built from
+//
+
+package main
+
+import (
+	"runtime/debug"
+)
+
+// set at build time (-ldflags "-X main.importerVersion=..."), otherwise taken from the
+// build information
+var importerVersion = ""
+
+// the provenance fields, the run specific ones change each time a work is imported
+const (
+	provenanceVersion = "import-version"     // importer version or commit
+	provenanceRun     = "import-run"         // run identifier
+	provenanceDate    = "import-date"        // when the object was built
+	provenanceExport  = "import-export"      // the export directory or archive
+	provenancePath    = "import-path"        // the work directory within the export
+	provenanceWorkId  = "import-work-id"     // the work identifier in the export
+	provenanceHash    = "import-work-sha256" // hash of the export work.json
+)
+
+// the provenance fields that differ between runs of the same export
+var runSpecificFields = []string{provenanceVersion, provenanceRun, provenanceDate, provenanceExport}
+
+// the importer version, the build time value if there is one, otherwise the VCS revision
+// from the build information
+func buildVersion() string {
+	if len(importerVersion) != 0 {
+		return importerVersion
+	}
+	info, ok := debug.ReadBuildInfo()
+	if ok == false {
+		return "unknown"
+	}
+	revision, modified := "", false
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if len(revision) == 0 {
+		if len(info.Main.Version) == 0 {
+			return "unknown"
+		}
+		return info.Main.Version
+	}
+	if modified == true {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// stamp the object fields with the provenance of the work
+func addProvenance(fields map[string]string, run importRun, dirname string, workId string, workHash string) {
+	fields[provenanceVersion] = run.version
+	fields[provenanceRun] = run.id
+	fields[provenanceDate] = run.started.Format("2006-01-02T15:04:05Z")
+	fields[provenanceExport] = run.export
+	fields[provenancePath] = relativePath(run.root, dirname)
+	fields[provenanceWorkId] = workId
+	fields[provenanceHash] = workHash
+}
+
+//
+// end of file
+//
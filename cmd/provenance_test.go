@@ -0,0 +1,52 @@
+//
+// tests for the import provenance
+//
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuildVersion(t *testing.T) {
+	if len(buildVersion()) == 0 {
+		t.Errorf("expected a version from the build information")
+	}
+	saved := importerVersion
+	defer func() { importerVersion = saved }()
+	importerVersion = "abc1234"
+	if v := buildVersion(); v != "abc1234" {
+		t.Errorf("expected the build time version, got %q", v)
+	}
+}
+
+func TestAddProvenance(t *testing.T) {
+
+	when := time.Date(2024, 5, 6, 7, 8, 9, 0, time.FixedZone("EST", -5*3600))
+	run := importRun{id: "run-1", version: "v1", root: "/exports", export: "s3://bucket/exports", started: when.UTC()}
+	fields := make(map[string]string)
+	addProvenance(fields, run, "/exports/2019/abc", "abc", "f00d")
+
+	expected := map[string]string{
+		provenanceVersion: "v1",
+		provenanceRun:     "run-1",
+		provenanceDate:    "2024-05-06T12:08:09Z",
+		provenanceExport:  "s3://bucket/exports",
+		provenancePath:    "2019/abc",
+		provenanceWorkId:  "abc",
+		provenanceHash:    "f00d",
+	}
+	for k, v := range expected {
+		if fields[k] != v {
+			t.Errorf("%s: expected %q, got %q", k, v, fields[k])
+		}
+	}
+	if len(fields) != len(expected) {
+		t.Errorf("unexpected fields %v", fields)
+	}
+}
+
+//
+// end of file
+//
@@ -0,0 +1,208 @@
+//
+// related URL normalization, the exports contain bare domains, DOI strings, malformed values
+// and links to the old Libra. Everything here is done offline, no links are checked
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// how we handle related URLs that are not valid, URLs with a scheme we do not accept
+// (javascript:, data: and so on) are always dropped
+var badUrlPolicies = []string{"flag", "drop"}
+
+// the URL has a scheme we do not accept
+var errUnsupportedScheme = errors.New("has an unsupported scheme")
+
+// the hosts of the old Libra systems, links to them are rewritten
+var legacyLibraHosts = []string{"libra.virginia.edu", "libra2.lib.virginia.edu", "libra-etd.lib.virginia.edu"}
+
+// the work pages of the old Libra systems, the last part is the work identifier
+var legacyLibraPathRe = regexp.MustCompile(`^/(?:public_view|catalog|show|concern/[a-z_]+)/([^/]+)/?$`)
+
+// DOI strings and DOI resolver links
+var doiRe = regexp.MustCompile(`(?i)^(?:doi:\s*|https?://(?:dx\.)?doi\.org/)?(10\.\d{4,9}/\S+)$`)
+
+// a leading scheme, the rest distinguishes a host and port (host:8080/path)
+var urlSchemeRe = regexp.MustCompile(`^([a-z][a-z0-9+.-]*):(.*)$`)
+var hostPortRe = regexp.MustCompile(`^[0-9]+(?:[/?#].*)?$`)
+
+// host names we accept
+var hostRe = regexp.MustCompile(`^(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,}$`)
+
+// the schemes we accept
+var urlSchemes = []string{"http", "https", "ftp"}
+
+type relatedUrlPolicy struct {
+	badUrls string            // invalid URL handling (flag|drop)
+	baseUrl string            // base URL for works without a DOI, empty if there is none
+	legacy  map[string]string // legacy work identifier -> new URL
+}
+
+// create the related URL policy, works without a DOI are linked to with the base URL
+func newRelatedUrlPolicy(badUrls string, baseUrl string) (*relatedUrlPolicy, error) {
+	if slices.Contains(badUrlPolicies, badUrls) == false {
+		return nil, fmt.Errorf("unsupported bad URL policy (%s)", badUrls)
+	}
+	if len(baseUrl) != 0 {
+		if _, err := url.ParseRequestURI(baseUrl); err != nil {
+			return nil, fmt.Errorf("bad base URL (%s)", baseUrl)
+		}
+	}
+	return &relatedUrlPolicy{badUrls: badUrls, baseUrl: baseUrl, legacy: make(map[string]string)}, nil
+}
+
+// index the works in the export so legacy links to them can be rewritten. Works are linked to
+// by DOI, or by the base URL if they do not have one
+func (p *relatedUrlPolicy) indexWorks(dirs []string) {
+	if p == nil {
+		return
+	}
+	for _, dirname := range dirs {
+		buf, err := loadFile(fmt.Sprintf("%s/work.json", dirname))
+		if err != nil {
+			continue
+		}
+		work := EtdWorkJson{}
+		if err = decodeJson(buf, &work); err != nil || len(work.Id.value) == 0 {
+			continue
+		}
+
+		target := ""
+		if len(work.PermanentUrl.value) != 0 {
+			target = fmt.Sprintf("https://doi.org/%s", cleanupDoi(work.PermanentUrl.value))
+		} else if len(p.baseUrl) != 0 {
+			target = p.baseUrl + url.PathEscape(work.Id.value)
+		}
+		if len(target) == 0 {
+			continue
+		}
+		p.addLegacy(work.Id.value, target)
+		if len(work.WorkSource.value) != 0 {
+			p.addLegacy(work.WorkSource.value, target)
+		}
+	}
+}
+
+// add the legacy identifier, when several works use it the first one is kept
+func (p *relatedUrlPolicy) addLegacy(id string, target string) {
+	existing, found := p.legacy[id]
+	if found == true {
+		if existing != target {
+			logWarning(fmt.Sprintf("legacy id (%s) is used by more than one work, linking it to %s and not %s", id, existing, target))
+		}
+		return
+	}
+	p.legacy[id] = target
+}
+
+// normalize the related URLs, invalid ones are dropped or kept according to the policy
+func (p *relatedUrlPolicy) apply(urls []string, wr *workReport) []string {
+	if p == nil {
+		return urls
+	}
+
+	result := make([]string, 0, len(urls))
+	for _, u := range urls {
+		u = strings.TrimSpace(u)
+		if len(u) == 0 {
+			continue
+		}
+		normalized, err := p.normalize(u)
+		if err != nil {
+			if p.badUrls == "drop" || errors.Is(err, errUnsupportedScheme) == true {
+				wr.logWarning(fmt.Sprintf("related url (%s) %s, dropping it", u, err.Error()))
+				continue
+			}
+			wr.logWarning(fmt.Sprintf("related url (%s) %s, keeping it", u, err.Error()))
+			normalized = u
+		}
+		if normalized != u {
+			logInfo(fmt.Sprintf("related url (%s) normalized to %s", u, normalized))
+		}
+		if slices.Contains(result, normalized) == false {
+			result = append(result, normalized)
+		}
+	}
+	return result
+}
+
+// normalize a single URL
+func (p *relatedUrlPolicy) normalize(str string) (string, error) {
+
+	// DOIs are linked to through the resolver
+	if m := doiRe.FindStringSubmatch(str); m != nil {
+		return fmt.Sprintf("https://doi.org/%s", m[1]), nil
+	}
+
+	// checked before anything else so values we keep cannot have a scheme we do not accept
+	scheme := urlScheme(str)
+	if len(scheme) != 0 && slices.Contains(urlSchemes, scheme) == false {
+		return "", errUnsupportedScheme
+	}
+
+	if strings.ContainsAny(str, " \t\r\n") == true {
+		return "", fmt.Errorf("contains whitespace")
+	}
+
+	// bare domains are assumed to be web sites
+	if len(scheme) == 0 {
+		str = fmt.Sprintf("https://%s", strings.TrimPrefix(str, "//"))
+	}
+
+	u, err := url.Parse(str)
+	if err != nil {
+		return "", fmt.Errorf("is malformed")
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if slices.Contains(urlSchemes, u.Scheme) == false {
+		return "", errUnsupportedScheme
+	}
+	if hostRe.MatchString(u.Hostname()) == false {
+		return "", fmt.Errorf("has a bad host")
+	}
+
+	// links to the old Libra are rewritten to the work in its new home
+	if slices.Contains(legacyLibraHosts, u.Hostname()) == true {
+		m := legacyLibraPathRe.FindStringSubmatch(u.Path)
+		if m == nil {
+			return "", fmt.Errorf("is a legacy Libra link that is not a work")
+		}
+		target, found := p.legacy[m[1]]
+		if found == false {
+			return "", fmt.Errorf("is a legacy Libra link to a work not in the export")
+		}
+		return target, nil
+	}
+
+	return u.String(), nil
+}
+
+// the scheme of the URL as a browser sees it (whitespace and control characters are ignored),
+// empty if there is none. A host and port is not a scheme
+func urlScheme(str string) string {
+	compact := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) == true || unicode.IsControl(r) == true {
+			return -1
+		}
+		return r
+	}, str)
+	m := urlSchemeRe.FindStringSubmatch(strings.ToLower(compact))
+	if m == nil || hostPortRe.MatchString(m[2]) == true {
+		return ""
+	}
+	return m[1]
+}
+
+//
+// end of file
+//
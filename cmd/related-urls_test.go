@@ -0,0 +1,117 @@
+//
+// tests for the related URL normalization
+//
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestNormalizeRelatedUrl(t *testing.T) {
+
+	p, _ := newRelatedUrlPolicy("flag", "https://libra.lib.virginia.edu/public_view/")
+	p.legacy["abc123"] = "https://doi.org/10.18130/v3-abc"
+	p.legacy["libra-oa:99"] = "https://doi.org/10.18130/v3-abc"
+
+	good := map[string]string{
+		"https://www.virginia.edu":                                   "https://www.virginia.edu",
+		"HTTP://WWW.Virginia.EDU/Path":                               "http://www.virginia.edu/Path",
+		"www.virginia.edu/history":                                   "https://www.virginia.edu/history",
+		"//www.virginia.edu":                                         "https://www.virginia.edu",
+		"ftp://ftp.example.org/file.txt":                             "ftp://ftp.example.org/file.txt",
+		"bare.host.org:8080/path":                                    "https://bare.host.org:8080/path",
+		"10.1000/xyz123":                                             "https://doi.org/10.1000/xyz123",
+		"doi: 10.1000/xyz123":                                        "https://doi.org/10.1000/xyz123",
+		"http://dx.doi.org/10.1000/xyz123":                           "https://doi.org/10.1000/xyz123",
+		"https://libra2.lib.virginia.edu/public_view/abc123":         "https://doi.org/10.18130/v3-abc",
+		"https://libra2.lib.virginia.edu/concern/libra_etds/abc123/": "https://doi.org/10.18130/v3-abc",
+		"http://libra.virginia.edu/catalog/libra-oa:99":              "https://doi.org/10.18130/v3-abc",
+	}
+	for in, expected := range good {
+		got, err := p.normalize(in)
+		if err != nil || got != expected {
+			t.Errorf("normalize(%q) = %q (%v), expected %q", in, got, err, expected)
+		}
+	}
+
+	bad := []string{
+		"not a url",
+		"javascript:alert(1)",
+		"mailto:someone@virginia.edu",
+		"https://localhost/page",
+		"https://",
+		"virginia",
+		"https://libra2.lib.virginia.edu/downloads/abc123",
+		"https://libra2.lib.virginia.edu/public_view/unknown",
+	}
+	for _, in := range bad {
+		if got, err := p.normalize(in); err == nil {
+			t.Errorf("normalize(%q) = %q, expected an error", in, got)
+		}
+	}
+}
+
+func TestRelatedUrlPolicy(t *testing.T) {
+
+	urls := []string{" www.virginia.edu ", "https://www.virginia.edu", "", "not a url", "javascript:alert(1)",
+		"java\tscript:alert(1)", "data:text/html,<script>alert(1)</script>"}
+
+	// unsupported schemes are dropped whatever the policy
+	flag, _ := newRelatedUrlPolicy("flag", "")
+	if got := flag.apply(urls, nil); slices.Equal(got, []string{"https://www.virginia.edu", "not a url"}) == false {
+		t.Errorf("unexpected flagged urls %q", got)
+	}
+	drop, _ := newRelatedUrlPolicy("drop", "")
+	if got := drop.apply(urls, nil); slices.Equal(got, []string{"https://www.virginia.edu"}) == false {
+		t.Errorf("unexpected dropped urls %q", got)
+	}
+
+	var none *relatedUrlPolicy
+	if got := none.apply(urls, nil); slices.Equal(got, urls) == false {
+		t.Errorf("expected the urls unchanged, got %q", got)
+	}
+
+	if _, err := newRelatedUrlPolicy("ignore", ""); err == nil {
+		t.Errorf("expected an error for an unsupported policy")
+	}
+	if _, err := newRelatedUrlPolicy("flag", "not a url"); err == nil {
+		t.Errorf("expected an error for a bad base url")
+	}
+}
+
+func TestIndexLegacyWorks(t *testing.T) {
+
+	p, _ := newRelatedUrlPolicy("flag", "https://libra.lib.virginia.edu/public_view/")
+	p.indexWorks(fixtureWorks(t))
+	if p.legacy["etd-basic-0001"] != "https://doi.org/10.18130/v3-basic" || p.legacy["libra-oa:1234"] != "https://doi.org/10.18130/v3-basic" {
+		t.Errorf("expected works with a DOI to be linked by DOI, got %v", p.legacy)
+	}
+	for id, target := range p.legacy {
+		if len(target) == 0 {
+			t.Errorf("%s: empty target", id)
+		}
+	}
+
+	// works sharing a legacy id, the first one keeps it
+	dirs := make([]string, 0)
+	for _, w := range []string{`{"id": "w1", "work_source": "libra-oa:1"}`, `{"id": "w2", "work_source": "libra-oa:1"}`} {
+		dirname := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dirname, "work.json"), []byte(w), 0644); err != nil {
+			t.Fatalf("writing work (%s)", err.Error())
+		}
+		dirs = append(dirs, dirname)
+	}
+	shared, _ := newRelatedUrlPolicy("flag", "https://libra.lib.virginia.edu/public_view/")
+	shared.indexWorks(dirs)
+	if shared.legacy["libra-oa:1"] != "https://libra.lib.virginia.edu/public_view/w1" || shared.legacy["w2"] != "https://libra.lib.virginia.edu/public_view/w2" {
+		t.Errorf("expected the first work to keep the shared id, got %v", shared.legacy)
+	}
+}
+
+//
+// end of file
+//
@@ -0,0 +1,215 @@
+//
+// text cleanup, the titles, abstracts and keywords exported from Hyrax contain entities, markup,
+// odd line endings and sometimes double encoded UTF-8 so we tidy them up before they are stored
+//
+
+package main
+
+import (
+	"fmt"
+	"github.com/uvalib/libra-metadata"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// the cleanup stages, they are always applied in this order. Markup is stripped before the
+// entities are decoded so escaped text (&lt;div&gt;) is kept as text
+var cleanupStages = []string{"mojibake", "html", "entities", "nfc", "whitespace", "keywords"}
+
+// the stages used if nothing else is specified
+var defaultCleanupStages = "mojibake,html,entities,nfc,whitespace,keywords"
+
+// tags that separate blocks of text, they are replaced with a line break when stripped
+var blockTags = []string{"p", "br", "div", "li", "ul", "ol", "h1", "h2", "h3", "h4", "h5", "h6", "blockquote"}
+
+// keyword separators, commas only separate keywords when the export put them all in one value
+var keywordSeparators = ";|\n"
+
+// the HTML elements we recognize, anything else that looks like a tag (x<y and y>z) is text
+var htmlElements = []string{"a", "abbr", "acronym", "address", "article", "aside", "b", "bdi", "bdo", "big",
+	"blockquote", "body", "br", "caption", "center", "cite", "code", "col", "colgroup", "dd", "del", "dfn",
+	"div", "dl", "dt", "em", "figcaption", "figure", "font", "footer", "h1", "h2", "h3", "h4", "h5", "h6",
+	"head", "header", "hr", "html", "i", "img", "ins", "kbd", "li", "link", "mark", "meta", "nav", "ol",
+	"p", "pre", "q", "s", "samp", "section", "small", "span", "strike", "strong", "style", "sub", "sup",
+	"table", "tbody", "td", "tfoot", "th", "thead", "title", "tr", "tt", "u", "ul", "var", "wbr"}
+
+var htmlTagRe = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9]*)((?:\s+[a-zA-Z_:][-a-zA-Z0-9_:.]*(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'<>=]+))?)*)\s*/?>|<!--.*?-->`)
+var spaceRunRe = regexp.MustCompile(`[ \t\f\v\x{00a0}]+`)
+var blankLinesRe = regexp.MustCompile(`\n{3,}`)
+
+// characters that commonly appear when UTF-8 has been decoded as Windows-1252 (or Latin-1)
+var mojibakeMarkers = "ÃÂâÅÄ"
+
+type textCleanup struct {
+	stages    []string // the enabled stages
+	allowTags []string // HTML tags kept by the html stage, the others are stripped
+}
+
+// create the text cleanup from a list of stages (stage,stage) or none and a list of allowed
+// HTML tags (tag,tag)
+func newTextCleanup(stages string, allowTags string) (textCleanup, error) {
+	c := textCleanup{stages: make([]string, 0), allowTags: make([]string, 0)}
+	if stages != "none" {
+		for _, s := range strings.Split(stages, ",") {
+			s = strings.TrimSpace(s)
+			if len(s) == 0 {
+				continue
+			}
+			if slices.Contains(cleanupStages, s) == false {
+				return c, fmt.Errorf("unsupported cleanup stage (%s)", s)
+			}
+			c.stages = append(c.stages, s)
+		}
+	}
+	for _, t := range strings.Split(allowTags, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if len(t) != 0 {
+			c.allowTags = append(c.allowTags, t)
+		}
+	}
+	return c, nil
+}
+
+func (c textCleanup) enabled(stage string) bool {
+	return slices.Contains(c.stages, stage)
+}
+
+// clean up the title, abstract and keywords
+func (c textCleanup) apply(meta *librametadata.ETDWork) {
+	meta.Title = c.cleanLine(meta.Title)
+	meta.Abstract = c.cleanText(meta.Abstract)
+	meta.Keywords = c.cleanKeywords(meta.Keywords)
+}
+
+// clean up text that may contain paragraphs
+func (c textCleanup) cleanText(str string) string {
+	str = c.cleanCommon(str)
+	if c.enabled("whitespace") == true {
+		lines := strings.Split(str, "\n")
+		for ix := range lines {
+			lines[ix] = strings.TrimSpace(spaceRunRe.ReplaceAllString(lines[ix], " "))
+		}
+		str = blankLinesRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+		str = strings.TrimSpace(str)
+	}
+	return str
+}
+
+// clean up text that is a single line
+func (c textCleanup) cleanLine(str string) string {
+	str = c.cleanCommon(str)
+	if c.enabled("whitespace") == true {
+		str = strings.Join(strings.Fields(str), " ")
+	}
+	return str
+}
+
+// the stages common to all text
+func (c textCleanup) cleanCommon(str string) string {
+	if c.enabled("mojibake") == true {
+		str = repairMojibake(str)
+	}
+	if c.enabled("html") == true {
+		str = stripHtml(str, c.allowTags)
+	}
+	if c.enabled("entities") == true {
+		str = html.UnescapeString(str)
+	}
+	if c.enabled("nfc") == true {
+		str = norm.NFC.String(str)
+	}
+	if c.enabled("whitespace") == true {
+		str = strings.ReplaceAll(str, "\r\n", "\n")
+		str = strings.ReplaceAll(str, "\r", "\n")
+	}
+	return str
+}
+
+// clean up each keyword, split values containing several keywords and remove duplicates
+func (c textCleanup) cleanKeywords(keywords []string) []string {
+
+	if c.enabled("keywords") == true {
+		separators := keywordSeparators
+		if len(keywords) == 1 {
+			separators += ","
+		}
+		split := make([]string, 0, len(keywords))
+		for _, k := range keywords {
+			split = append(split, strings.FieldsFunc(k, func(r rune) bool {
+				return strings.ContainsRune(separators, r)
+			})...)
+		}
+		keywords = split
+	}
+
+	result := make([]string, 0, len(keywords))
+	seen := make(map[string]bool)
+	for _, k := range keywords {
+		k = c.cleanLine(k)
+		if c.enabled("keywords") == true {
+			key := strings.ToLower(k)
+			if len(k) == 0 || seen[key] == true {
+				continue
+			}
+			seen[key] = true
+		}
+		result = append(result, k)
+	}
+	return result
+}
+
+// remove the HTML markup other than the allowed tags, the allowed tags lose their attributes.
+// Only the HTML elements are markup, anything else is left alone
+func stripHtml(str string, allowTags []string) string {
+	return htmlTagRe.ReplaceAllStringFunc(str, func(tag string) string {
+		m := htmlTagRe.FindStringSubmatch(tag)
+		name := strings.ToLower(m[2])
+		switch {
+		case strings.HasPrefix(tag, "<!--") == true:
+			// a comment
+			return ""
+		case slices.Contains(htmlElements, name) == false:
+			return tag
+		case slices.Contains(allowTags, name) == true:
+			return fmt.Sprintf("<%s%s>", m[1], name)
+		case slices.Contains(blockTags, name) == true:
+			return "\n"
+		}
+		return ""
+	})
+}
+
+// repair UTF-8 that has been decoded as Windows-1252 (or Latin-1), the repair is only made if
+// every character converts back and the result is valid UTF-8
+func repairMojibake(str string) string {
+	if strings.ContainsAny(str, mojibakeMarkers) == false {
+		return str
+	}
+	buf := make([]byte, 0, len(str))
+	for _, r := range str {
+		switch {
+		case r < 0x100:
+			// Latin-1 also covers the code points Windows-1252 leaves undefined
+			buf = append(buf, byte(r))
+		default:
+			b, ok := charmap.Windows1252.EncodeRune(r)
+			if ok == false {
+				return str
+			}
+			buf = append(buf, b)
+		}
+	}
+	if utf8.Valid(buf) == false {
+		return str
+	}
+	return string(buf)
+}
+
+//
+// end of file
+//
@@ -0,0 +1,119 @@
+//
+// tests for the text cleanup
+//
+
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// the cleanup used if nothing else is specified
+func defaultTextCleanup() textCleanup {
+	c, _ := newTextCleanup(defaultCleanupStages, "")
+	return c
+}
+
+func TestRepairMojibake(t *testing.T) {
+	tests := map[string]string{
+		"CafÃ©":             "Café",
+		"â€œquotedâ€\u009d": "“quoted”",
+		"plain text":        "plain text",
+		"SÃO PAULO":         "SÃO PAULO", // not mojibake, does not convert
+		"CafÃ© and 日本":      "CafÃ© and 日本",
+		"already Café":      "already Café",
+		"naÃ¯ve rÃ©sumÃ©":   "naïve résumé",
+	}
+	for in, expected := range tests {
+		if got := repairMojibake(in); got != expected {
+			t.Errorf("repairMojibake(%q) = %q, expected %q", in, got, expected)
+		}
+	}
+}
+
+func TestStripHtml(t *testing.T) {
+	tests := []struct {
+		in       string
+		allow    []string
+		expected string
+	}{
+		{"<b>bold</b> and <I class=\"x\">italic</I>", nil, "bold and italic"},
+		{"<b>bold</b> and <I class=\"x\">italic</I>", []string{"i"}, "bold and <i>italic</i>"},
+		{"one<br/>two<p>three</p>", nil, "one\ntwo\nthree\n"},
+		{"a < b and b > c", nil, "a < b and b > c"},
+		{"text<!-- comment -->", nil, "text"},
+		{"x<y and y>z", nil, "x<y and y>z"},
+		{"the &lt;div&gt; element", nil, "the &lt;div&gt; element"},
+		{"<a href='x' title=\"a > b\">link</a>", nil, "link"},
+		{"<span data-x=1 hidden>text</span>", nil, "text"},
+	}
+	for _, test := range tests {
+		if got := stripHtml(test.in, test.allow); got != test.expected {
+			t.Errorf("stripHtml(%q) = %q, expected %q", test.in, got, test.expected)
+		}
+	}
+}
+
+func TestCleanText(t *testing.T) {
+
+	all := defaultTextCleanup()
+	if got := all.cleanLine("  A\r\n title &amp;\tmore "); got != "A title & more" {
+		t.Errorf("unexpected line %q", got)
+	}
+	if got := all.cleanText(" one  \r\n\r\n\r\n\r\n two "); got != "one\n\ntwo" {
+		t.Errorf("unexpected text %q", got)
+	}
+	if got := all.cleanLine("the &lt;div&gt; element"); got != "the <div> element" {
+		t.Errorf("expected escaped markup to be kept as text, got %q", got)
+	}
+	if got := all.cleanLine("x<y and y>z"); got != "x<y and y>z" {
+		t.Errorf("expected comparisons to be kept, got %q", got)
+	}
+	if got := all.cleanLine("e\u0301"); got != "\u00e9" {
+		t.Errorf("expected NFC, got %q", got)
+	}
+
+	// only the enabled stages are applied
+	entities, _ := newTextCleanup("entities", "")
+	if got := entities.cleanLine(" <b>&amp;</b> "); got != " <b>&</b> " {
+		t.Errorf("unexpected line %q", got)
+	}
+	none, _ := newTextCleanup("none", "")
+	if got := none.cleanLine(" <b>&amp;</b> "); got != " <b>&amp;</b> " {
+		t.Errorf("unexpected line %q", got)
+	}
+
+	if _, err := newTextCleanup("nfc,spelling", ""); err == nil {
+		t.Errorf("expected an error for an unsupported stage")
+	}
+}
+
+func TestCleanKeywords(t *testing.T) {
+
+	all := defaultTextCleanup()
+	tests := []struct {
+		in       []string
+		expected []string
+	}{
+		{[]string{"a; b", "A", " b ", "c|d"}, []string{"a", "b", "c", "d"}},
+		{[]string{"a, b, c"}, []string{"a", "b", "c"}},
+		{[]string{"Smith, John", "history"}, []string{"Smith, John", "history"}},
+		{[]string{"", "  "}, []string{}},
+	}
+	for _, test := range tests {
+		if got := all.cleanKeywords(test.in); slices.Equal(got, test.expected) == false {
+			t.Errorf("cleanKeywords(%q) = %q, expected %q", test.in, got, test.expected)
+		}
+	}
+
+	// without the keyword stage the keywords are only tidied
+	lines, _ := newTextCleanup("whitespace", "")
+	if got := lines.cleanKeywords([]string{" a; b ", "a; b"}); slices.Equal(got, []string{"a; b", "a; b"}) == false {
+		t.Errorf("unexpected keywords %q", got)
+	}
+}
+
+//
+// end of file
+//
@@ -0,0 +1,88 @@
+//
+// a simple rate limiter with adaptive slowdown, used to keep bulk imports from
+// overwhelming a shared service
+//
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// the most we will slow down by and how quickly we recover
+const maxSlowdown = 16.0
+const slowdownRecovery = 0.9
+
+// without a rate the slowdown spaces the units by this much for each step above full speed
+const unlimitedSlowdownInterval = 100 * time.Millisecond
+
+type rateLimiter struct {
+	sync.Mutex
+	rate     float64   // units per second, 0 for no limit
+	slowdown float64   // the current slowdown factor (1 is full speed)
+	next     time.Time // when the next unit is available
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	return &rateLimiter{rate: rate, slowdown: 1.0}
+}
+
+// wait until we can consume the specified number of units
+func (rl *rateLimiter) take(units float64) {
+	if rl == nil {
+		return
+	}
+
+	rl.Lock()
+	now := time.Now()
+	if rl.next.Before(now) {
+		rl.next = now
+	}
+	start := rl.next
+	if rl.rate > 0 {
+		rl.next = rl.next.Add(time.Duration(units * rl.slowdown / rl.rate * float64(time.Second)))
+	} else if rl.slowdown > 1.0 {
+		rl.next = rl.next.Add(time.Duration(units * (rl.slowdown - 1.0) * float64(unlimitedSlowdownInterval)))
+	}
+	rl.Unlock()
+
+	time.Sleep(time.Until(start))
+}
+
+// the service is struggling, slow down (and do nothing until the specified time)
+func (rl *rateLimiter) backoff(until time.Time) {
+	if rl == nil {
+		return
+	}
+	rl.Lock()
+	defer rl.Unlock()
+	rl.slowdown = min(rl.slowdown*2, maxSlowdown)
+	if until.After(rl.next) {
+		rl.next = until
+	}
+}
+
+// the service is responding normally, speed back up
+func (rl *rateLimiter) recover() {
+	if rl == nil {
+		return
+	}
+	rl.Lock()
+	defer rl.Unlock()
+	rl.slowdown = max(rl.slowdown*slowdownRecovery, 1.0)
+}
+
+// the current slowdown factor
+func (rl *rateLimiter) factor() float64 {
+	if rl == nil {
+		return 1.0
+	}
+	rl.Lock()
+	defer rl.Unlock()
+	return rl.slowdown
+}
+
+//
+// end of file
+//
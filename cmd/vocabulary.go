@@ -0,0 +1,180 @@
+//
+// program and degree vocabulary mapping, the department and degree values have drifted over
+// the years so legacy values are mapped to the current Libra ETD vocabularies
+//
+
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// the vocabularies we map
+const (
+	vocabProgram = "program"
+	vocabDegree  = "degree"
+)
+
+// the bundled mapping table, one row per vocabulary term, exact match or regex rule
+//
+//go:embed data/vocabulary.csv
+var vocabularyCsv []byte
+
+// a regex rule, the value may refer to the capture groups ($1)
+type vocabularyRule struct {
+	re    *regexp.Regexp
+	value string
+}
+
+// the mapping for one vocabulary
+type vocabularyMap struct {
+	terms map[string]string // normalized term -> term
+	exact map[string]string // normalized legacy value -> term
+	rules []vocabularyRule  // applied in order, the first match wins
+}
+
+type vocabulary struct {
+	maps map[string]*vocabularyMap // by vocabulary name
+}
+
+// load the bundled table and the override file (if specified), the override rules are tried
+// before the bundled ones
+func newVocabulary(overrideFile string) (*vocabulary, error) {
+
+	v := &vocabulary{maps: make(map[string]*vocabularyMap)}
+	if len(overrideFile) != 0 {
+		buf, err := os.ReadFile(overrideFile)
+		if err != nil {
+			return nil, err
+		}
+		if err = v.load(buf, overrideFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := v.load(vocabularyCsv, "bundled vocabulary"); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// load the mapping table (field,kind,match,value), earlier entries take precedence
+func (v *vocabulary) load(buf []byte, name string) error {
+
+	r := csv.NewReader(bytes.NewReader(buf))
+	r.FieldsPerRecord = 4
+	r.Comment = '#'
+	records, err := r.ReadAll()
+	if err != nil {
+		return fmt.Errorf("reading %s (%s)", name, err.Error())
+	}
+
+	for ix, rec := range records {
+		// skip the header
+		if ix == 0 && rec[0] == "field" {
+			continue
+		}
+		field, kind, match, value := strings.TrimSpace(rec[0]), strings.TrimSpace(rec[1]), rec[2], strings.TrimSpace(rec[3])
+		if field != vocabProgram && field != vocabDegree {
+			return fmt.Errorf("%s line %d: unsupported field (%s)", name, ix+1, field)
+		}
+		if len(value) == 0 {
+			return fmt.Errorf("%s line %d: missing value", name, ix+1)
+		}
+		m := v.maps[field]
+		if m == nil {
+			m = &vocabularyMap{terms: make(map[string]string), exact: make(map[string]string)}
+			v.maps[field] = m
+		}
+
+		switch kind {
+		case "term":
+			if _, found := m.terms[vocabularyKey(value)]; found == false {
+				m.terms[vocabularyKey(value)] = value
+			}
+		case "exact":
+			if _, found := m.exact[vocabularyKey(match)]; found == false {
+				m.exact[vocabularyKey(match)] = value
+			}
+		case "regex":
+			re, err := regexp.Compile(match)
+			if err != nil {
+				return fmt.Errorf("%s line %d: bad regex (%s)", name, ix+1, err.Error())
+			}
+			m.rules = append(m.rules, vocabularyRule{re: re, value: value})
+		default:
+			return fmt.Errorf("%s line %d: unsupported kind (%s), must be term|exact|regex", name, ix+1, kind)
+		}
+	}
+	return nil
+}
+
+// map the value to the vocabulary, returns the mapped value and true if it is a vocabulary
+// term. Values we cannot map to a term are returned as they are, even when a rule rewrote them
+func (v *vocabulary) lookup(field string, value string) (string, bool) {
+
+	m := v.maps[field]
+	if m == nil || len(strings.TrimSpace(value)) == 0 {
+		return value, true
+	}
+
+	key := vocabularyKey(value)
+	if term, found := m.terms[key]; found == true {
+		return term, true
+	}
+	if mapped, found := m.exact[key]; found == true {
+		if term, found := m.canonical(mapped); found == true {
+			return term, true
+		}
+		return value, false
+	}
+
+	trimmed := strings.TrimSpace(value)
+	for _, r := range m.rules {
+		match := r.re.FindStringSubmatchIndex(trimmed)
+		if match != nil {
+			if term, found := m.canonical(string(r.re.ExpandString(nil, r.value, trimmed, match))); found == true {
+				return term, true
+			}
+			return value, false
+		}
+	}
+	return value, false
+}
+
+// the vocabulary form of the mapped value, if there is one
+func (m *vocabularyMap) canonical(value string) (string, bool) {
+	term, found := m.terms[vocabularyKey(value)]
+	return term, found
+}
+
+// map the work program and degree, values we cannot map are reported
+func (v *vocabulary) apply(program *string, degree *string, wr *workReport) {
+	if v == nil {
+		return
+	}
+	for _, f := range []struct {
+		name  string
+		value *string
+	}{{vocabProgram, program}, {vocabDegree, degree}} {
+		mapped, found := v.lookup(f.name, *f.value)
+		if found == false {
+			wr.logWarning(fmt.Sprintf("unmapped %s (%s), keeping it", f.name, *f.value))
+		}
+		*f.value = mapped
+	}
+}
+
+// case and whitespace are not significant when matching
+func vocabularyKey(str string) string {
+	return strings.ToLower(strings.Join(strings.Fields(str), " "))
+}
+
+//
+// end of file
+//
@@ -0,0 +1,97 @@
+//
+// tests for the program and degree vocabulary mapping
+//
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// the bundled vocabulary, the table is part of the build so an error is a programming error
+func defaultVocabulary() *vocabulary {
+	v, err := newVocabulary("")
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func TestVocabularyLookup(t *testing.T) {
+
+	v := defaultVocabulary()
+	tests := []struct {
+		field    string
+		value    string
+		expected string
+		found    bool
+	}{
+		{vocabProgram, "Department of English", "Department of English", true},
+		{vocabProgram, " department  of english ", "Department of English", true},
+		{vocabProgram, "Dept. of English", "Department of English", true},
+		{vocabProgram, "English - Graduate School of Arts and Sciences", "Department of English", true},
+		{vocabProgram, "Government and Foreign Affairs", "Department of Politics", true},
+		{vocabProgram, "History - Graduate School of Arts and Sciences", "Department of History", true},
+		{vocabProgram, "Dept of Underwater Basket Weaving", "Dept of Underwater Basket Weaving", false},
+		{vocabProgram, " Dept. of Underwater Basketweaving ", " Dept. of Underwater Basketweaving ", false},
+		{vocabProgram, "Basket Weaving", "Basket Weaving", false},
+		{vocabProgram, "", "", true},
+		{vocabDegree, "Ph.D.", "PHD (Doctor of Philosophy)", true},
+		{vocabDegree, "Doctor of Philosophy", "PHD (Doctor of Philosophy)", true},
+		{vocabDegree, "M.A.", "MA (Master of Arts)", true},
+		{vocabDegree, "MArch", "MARCH (Master of Architecture)", true},
+		{vocabDegree, "Diploma", "Diploma", false},
+	}
+
+	for _, test := range tests {
+		got, found := v.lookup(test.field, test.value)
+		if got != test.expected || found != test.found {
+			t.Errorf("lookup(%s, %q) = %q %t, expected %q %t", test.field, test.value, got, found, test.expected, test.found)
+		}
+	}
+}
+
+func TestVocabularyOverride(t *testing.T) {
+
+	override := filepath.Join(t.TempDir(), "override.csv")
+	table := "field,kind,match,value\n" +
+		"# local additions\n" +
+		"program,term,,Department of Basket Weaving\n" +
+		"program,exact,English,Department of Basket Weaving\n" +
+		"degree,regex,(?i)^diploma$,MA (Master of Arts)\n"
+	if err := os.WriteFile(override, []byte(table), 0644); err != nil {
+		t.Fatalf("writing override (%s)", err.Error())
+	}
+
+	v, err := newVocabulary(override)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err.Error())
+	}
+	if got, found := v.lookup(vocabProgram, "english"); got != "Department of Basket Weaving" || found == false {
+		t.Errorf("expected the override to win, got %q %t", got, found)
+	}
+	if got, found := v.lookup(vocabProgram, "Dept. of Basket Weaving"); got != "Department of Basket Weaving" || found == false {
+		t.Errorf("expected the bundled rule to map to the override term, got %q %t", got, found)
+	}
+	if got, _ := v.lookup(vocabDegree, "Diploma"); got != "MA (Master of Arts)" {
+		t.Errorf("expected the override rule, got %q", got)
+	}
+
+	bad := []string{
+		"school,term,,School of Law\n",
+		"program,fuzzy,English,Department of English\n",
+		"program,regex,(unclosed,Department of English\n",
+		"program,exact,English,\n",
+	}
+	for _, b := range bad {
+		if err := (&vocabulary{maps: make(map[string]*vocabularyMap)}).load([]byte(b), "test"); err == nil {
+			t.Errorf("%q: expected an error", b)
+		}
+	}
+}
+
+//
+// end of file
+//